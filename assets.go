@@ -0,0 +1,10 @@
+// Package propertyproject embeds the web assets so the server binary is
+// self-contained.
+package propertyproject
+
+import "embed"
+
+// Assets holds the templates and static files, rooted at the project root.
+//
+//go:embed templates static
+var Assets embed.FS
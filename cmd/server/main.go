@@ -1,16 +1,58 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
 	"propertyProject/internal"
+	"syscall"
 )
 
 func main() {
-	cfg := internal.LoadConfig()
-	server := internal.NewServer(cfg)
+	validate := flag.Bool("validate", os.Getenv("VALIDATE") == "1", "check the config and templates, then exit without serving")
+	flag.Parse()
 
-	log.Printf("Starting server on %s\n", cfg.Port)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server error: %v", err)
+	cfg, err := internal.LoadConfig()
+	if err != nil {
+		slog.Error("invalid config", slog.Any("error", err))
+		os.Exit(1)
 	}
+
+	if *validate {
+		if err := internal.Validate(cfg); err != nil {
+			slog.Error("validation failed", slog.Any("error", err))
+			os.Exit(1)
+		}
+		slog.Info("config and templates are valid")
+		return
+	}
+
+	server, err := internal.NewServer(cfg)
+	if err != nil {
+		slog.Error("startup failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	logger := server.Logger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go server.WatchReload(ctx, reload, internal.LoadConfig)
+
+	ln, err := server.Listen()
+	if err != nil {
+		logger.Error("listen failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	logger.Info("starting server", slog.String("addr", ln.Addr().String()), slog.String("env", cfg.Env), slog.Any("config", cfg))
+	if err := server.Run(ctx, ln); err != nil {
+		logger.Error("server failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	logger.Info("server stopped")
 }
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// CachingGreeter remembers the greetings another Greeter returns for each
+// location for a TTL, so slow backends are asked at most once per location
+// per TTL. Locations are cached under the known location they resolve to,
+// when the greeter can say, so aliases and made-up sub-locations share an
+// entry, and expired entries are swept out at most once per TTL as new ones
+// are added. Errors are not cached. It is safe for concurrent use.
+type CachingGreeter struct {
+	Greeter
+	ttl   time.Duration
+	clock func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	nextSweep time.Time
+}
+
+type cacheEntry struct {
+	greeting string
+	expires  time.Time
+}
+
+type CachingOption func(*CachingGreeter)
+
+// WithCacheClock sets the clock entries expire by.
+func WithCacheClock(clock func() time.Time) CachingOption {
+	return func(c *CachingGreeter) {
+		c.clock = clock
+	}
+}
+
+// NewCachingGreeter caches next's greetings for ttl.
+func NewCachingGreeter(next Greeter, ttl time.Duration, opts ...CachingOption) *CachingGreeter {
+	c := &CachingGreeter{
+		Greeter: next,
+		ttl:     ttl,
+		clock:   time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Unwrap returns the greeter c wraps.
+func (c *CachingGreeter) Unwrap() Greeter {
+	return c.Greeter
+}
+
+func (c *CachingGreeter) GreetE(location string) (string, error) {
+	return c.GreetCtx(context.Background(), location)
+}
+
+func (c *CachingGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	key := location
+	if resolver, ok := greeterAs[locationResolver](c.Greeter); ok {
+		resolved, ok := resolver.ResolveLocation(location)
+		if !ok {
+			return c.Greeter.GreetCtx(ctx, location)
+		}
+		key = resolved
+	}
+	if greeting, ok := c.cached(key); ok {
+		return greeting, nil
+	}
+
+	greeting, err := c.Greeter.GreetCtx(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	c.store(key, greeting)
+	return greeting, nil
+}
+
+// Invalidate forgets the greeting cached for the known location, so a
+// greeting registered for it is served straight away.
+func (c *CachingGreeter) Invalidate(location string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, location)
+}
+
+// Len returns how many entries c holds, expired ones included until they
+// are swept.
+func (c *CachingGreeter) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *CachingGreeter) cached(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !c.clock().Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.greeting, true
+}
+
+// store caches greeting under key, first sweeping out expired entries if
+// a TTL has passed since the last sweep.
+func (c *CachingGreeter) store(key, greeting string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	if !now.Before(c.nextSweep) {
+		maps.DeleteFunc(c.entries, func(_ string, entry cacheEntry) bool {
+			return !now.Before(entry.expires)
+		})
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = cacheEntry{greeting: greeting, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while a CircuitBreakerGreeter is refusing to
+// call its greeter.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is ErrCircuitOpen with how long the circuit stays open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error()
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerGreeter stops calling another Greeter for a cooldown once
+// it has failed threshold times in a row, failing fast with a
+// *CircuitOpenError instead. After the cooldown calls go through again; one
+// more failure reopens the circuit and a success closes it. Unknown
+// locations, and calls whose context was cancelled or ran out of time, are
+// not failures of the greeter. Only GreetE and GreetCtx go through the
+// breaker. It is safe for concurrent use.
+type CircuitBreakerGreeter struct {
+	Greeter
+	threshold int
+	cooldown  time.Duration
+	clock     func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+type CircuitBreakerOption func(*CircuitBreakerGreeter)
+
+// WithCircuitBreakerClock sets the clock the cooldown is timed by.
+func WithCircuitBreakerClock(clock func() time.Time) CircuitBreakerOption {
+	return func(c *CircuitBreakerGreeter) {
+		c.clock = clock
+	}
+}
+
+// NewCircuitBreakerGreeter opens the circuit around next after threshold
+// consecutive failures, for cooldown.
+func NewCircuitBreakerGreeter(next Greeter, threshold int, cooldown time.Duration, opts ...CircuitBreakerOption) *CircuitBreakerGreeter {
+	c := &CircuitBreakerGreeter{
+		Greeter:   next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Unwrap returns the greeter c wraps.
+func (c *CircuitBreakerGreeter) Unwrap() Greeter {
+	return c.Greeter
+}
+
+func (c *CircuitBreakerGreeter) GreetE(location string) (string, error) {
+	return c.GreetCtx(context.Background(), location)
+}
+
+func (c *CircuitBreakerGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	if wait := c.openFor(); wait > 0 {
+		return "", &CircuitOpenError{RetryAfter: wait}
+	}
+
+	greeting, err := c.Greeter.GreetCtx(ctx, location)
+	c.record(ctx, err)
+	return greeting, err
+}
+
+// openFor returns how much longer the circuit stays open.
+func (c *CircuitBreakerGreeter) openFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openUntil.Sub(c.clock())
+}
+
+// record counts the outcome of a call made with ctx. A call failing after
+// ctx has been cancelled or run out of time is the caller giving up, not
+// the greeter failing, so a client sending a short X-Request-Deadline
+// cannot open the circuit for everyone else.
+func (c *CircuitBreakerGreeter) record(ctx context.Context, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case err == nil:
+		c.failures = 0
+	case ctx.Err() != nil, errors.Is(err, ErrUnknownLocation), errors.Is(err, context.Canceled):
+	default:
+		c.failures++
+		if c.failures >= c.threshold {
+			c.openUntil = c.clock().Add(c.cooldown)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ClientIP returns the originating client address. X-Forwarded-For is only
+// believed when the peer is one of trustedProxies, and then only as far
+// back as the hops were added by trusted proxies: the result is the
+// right-most address that is not itself a trusted proxy. Anything further
+// left could have been written by the client.
+func ClientIP(r *http.Request, trustedProxies []net.IPNet) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer, trustedProxies) {
+		return peer
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := peer
+	for _, hop := range slices.Backward(hops) {
+		hop = strings.TrimSpace(hop)
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(addr string, trustedProxies []net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	return slices.ContainsFunc(trustedProxies, func(network net.IPNet) bool {
+		return network.Contains(ip)
+	})
+}
+
+// ParseTrustedProxies parses CIDR ranges, treating a bare IP as a range of
+// one address.
+func ParseTrustedProxies(cidrs []string) ([]net.IPNet, error) {
+	networks := make([]net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: not an IP or CIDR", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", cidr, err)
+		}
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
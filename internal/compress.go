@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultGzipMinSize is the smallest response body worth compressing;
+// anything shorter gains little and costs CPU.
+const DefaultGzipMinSize = 1024
+
+// GzipMiddleware compresses response bodies of at least minSize bytes for
+// clients that accept gzip, marking their ETag weak.
+func GzipMiddleware(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip. An
+// explicit gzip coding decides, whatever its position; otherwise a "*"
+// wildcard does. Codings with malformed q-values are ignored.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQuality, wildcardQuality := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		quality, ok := codingQuality(params)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQuality = quality
+		case "*":
+			wildcardQuality = quality
+		}
+	}
+	if gzipQuality >= 0 {
+		return gzipQuality > 0
+	}
+	return wildcardQuality > 0
+}
+
+// codingQuality returns the q-value among the parameters of an
+// Accept-Encoding coding, 1 when there is none, reporting whether it is
+// well formed.
+func codingQuality(params string) (float64, bool) {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+		quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || quality < 0 || quality > 1 {
+			return 0, false
+		}
+		return quality, true
+	}
+	return 1, true
+}
+
+// gzipResponseWriter buffers the start of the body until it knows whether
+// the response is large enough to compress, holding back the status line
+// until then.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.status = status
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide sends the headers, compressed or not, followed by the buffered body.
+func (gw *gzipResponseWriter) decide(compress bool) error {
+	gw.decided = true
+	header := gw.ResponseWriter.Header()
+
+	if compress && header.Get("Content-Encoding") == "" {
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(gw.buf))
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// The compressed bytes differ from the identity ones, so they cannot
+		// share a strong validator; a weak one still revalidates either.
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := gw.Write(buf)
+	return err
+}
+
+// Flush sends what has been written so far, compressing it only when it
+// already meets the minimum size.
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide(len(gw.buf) >= gw.minSize)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Close finishes the response, writing a short body uncompressed.
+func (gw *gzipResponseWriter) Close() error {
+	if !gw.decided {
+		if err := gw.decide(false); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
@@ -1,25 +1,416 @@
 package internal
 
-import "os"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvLocal      = "local"
+	EnvStaging    = "staging"
+	EnvProduction = "production"
+)
 
 type Config struct {
-	Env  string
-	Port string
+	Env             string        `yaml:"env"`
+	Host            string        `yaml:"host"` // empty binds all interfaces
+	Port            string        `yaml:"port"`
+	UnixSocket      string        `yaml:"unix_socket"` // listened on instead of Host and Port when set
+	LogLevel        slog.Level    `yaml:"log_level"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	HandlerTimeout  time.Duration `yaml:"handler_timeout"` // zero means no limit
+	WarmupDelay     time.Duration `yaml:"warmup_delay"`    // extra wait before reporting ready
+	TLSCertFile     string        `yaml:"tls_cert_file"`
+	TLSKeyFile      string        `yaml:"tls_key_file"`
+	AllowedOrigins  []string      `yaml:"allowed_origins"`
+	AllowedHosts    []string      `yaml:"allowed_hosts"` // empty allows any Host
+	// BasePath is the path prefix every route is served under, such as
+	// "/greeter" behind a proxy; empty serves from the root.
+	BasePath string `yaml:"base_path"`
+	// BlockedUserAgents are substrings of the User-Agent headers, matched
+	// regardless of case, whose requests are refused.
+	BlockedUserAgents []string `yaml:"blocked_user_agents"`
+	// ContentSecurityPolicy is sent on every response; empty omits it.
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+	// OTLPEndpoint is the base URL of the OTLP/HTTP collector traces are
+	// exported to; empty disables tracing.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// DefaultLocation is greeted in place of unknown locations; it must be
+	// one the greeter knows. Empty keeps World.
+	DefaultLocation string `yaml:"default_location"`
+	// GreetingsFile is a JSON file of location to greeting replacing the
+	// built-in greetings; empty keeps the built-ins.
+	GreetingsFile string `yaml:"greetings_file"`
+	// GreetingsReloadInterval is how often GreetingsFile is checked for
+	// changes while serving; zero never reloads it.
+	GreetingsReloadInterval time.Duration `yaml:"greetings_reload_interval"`
+	// RateLimitPerSecond is the average requests per second allowed per
+	// client IP; zero disables rate limiting.
+	RateLimitPerSecond float64 `yaml:"rate_limit_per_second"`
+	RateLimitBurst     int     `yaml:"rate_limit_burst"`
+	// CircuitBreakerThreshold is how many greetings in a row may fail
+	// before the greeter is given CircuitBreakerCooldown to recover; zero
+	// disables the breaker.
+	CircuitBreakerThreshold int           `yaml:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown  time.Duration `yaml:"circuit_breaker_cooldown"`
+	// TrustedProxies are the CIDR ranges of proxies whose X-Forwarded-For
+	// headers are believed when identifying clients.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// StaticCacheMaxAge is how long clients may cache static files; zero
+	// sends no Cache-Control header.
+	StaticCacheMaxAge time.Duration `yaml:"static_cache_max_age"`
+	// AdminToken authorises the /admin endpoints; empty disables them.
+	AdminToken string `yaml:"admin_token"`
+	// EnableH2C serves cleartext HTTP/2 alongside HTTP/1.1 for clients
+	// that use it without TLS.
+	EnableH2C bool `yaml:"enable_h2c"`
+	// MaxBodyBytes caps request body size; zero means no limit.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// MaxQueryLength caps the length of the raw query string and
+	// MaxQueryParams the number of parameters in it; zero means no limit.
+	MaxQueryLength int `yaml:"max_query_length"`
+	MaxQueryParams int `yaml:"max_query_params"`
+	// HistorySize is how many recent greetings /admin/history reports;
+	// zero keeps none.
+	HistorySize int `yaml:"history_size"`
+	// ForceHTTPS redirects requests a TLS-terminating proxy forwarded as
+	// plain HTTP, per X-Forwarded-Proto, to HTTPS.
+	ForceHTTPS bool `yaml:"force_https"`
+	// Maintenance starts the server in maintenance mode, with greeting
+	// routes answering 503 until it is switched off at /admin/maintenance.
+	Maintenance bool `yaml:"maintenance"`
+	// EnableDecorations suffixes greetings with their location's flag.
+	EnableDecorations bool `yaml:"enable_decorations"`
+	// EnableProfiling serves the pprof handlers under /debug/pprof outside
+	// EnvLocal too, where they are always served.
+	EnableProfiling bool `yaml:"enable_profiling"`
+	// ArtificialLatency delays every request by this long for chaos
+	// testing; zero disables it and production refuses it.
+	ArtificialLatency time.Duration `yaml:"artificial_latency"`
+	// Theme names the directory under templates/themes whose templates
+	// pages are rendered with; empty uses the default templates.
+	Theme string `yaml:"theme"`
+	// DisableKeepAlives closes every connection after one response, so
+	// proxies stop reusing connections to an instance being rolled out.
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+}
+
+// DefaultConfig returns the settings LoadConfig starts from, before the
+// config file and environment override them.
+func DefaultConfig() Config {
+	return Config{
+		Env:                    EnvLocal,
+		Port:                   "8080",
+		LogLevel:               slog.LevelInfo,
+		ReadTimeout:            5 * time.Second,
+		WriteTimeout:           10 * time.Second,
+		IdleTimeout:            120 * time.Second,
+		ShutdownTimeout:        10 * time.Second,
+		HandlerTimeout:         5 * time.Second,
+		RateLimitBurst:         1,
+		CircuitBreakerCooldown: 30 * time.Second,
+		MaxBodyBytes:           1 << 20,
+		MaxQueryLength:         2048,
+		MaxQueryParams:         32,
+		HistorySize:            DefaultHistorySize,
+		StaticCacheMaxAge:      time.Hour,
+		ContentSecurityPolicy:  "default-src 'self'",
+	}
 }
 
-func LoadConfig() Config {
-	env := os.Getenv("ENV")
-	if env == "" {
-		env = "local"
+// LoadConfig builds the config from defaults, then the YAML file named by
+// CONFIG_FILE if set, then individual env vars, each overriding the last.
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
 	}
 
-	return Config{
-		Env:  env,
-		Port: port,
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the settings in the YAML file at path. Unknown keys are
+// rejected so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays the settings from env vars that are set.
+func (c *Config) loadEnv() error {
+	var env envReader
+	env.string(&c.Env, "ENV")
+	env.string(&c.Host, "HOST")
+	env.string(&c.Port, "PORT")
+	env.string(&c.UnixSocket, "UNIX_SOCKET")
+	env.level(&c.LogLevel, "LOG_LEVEL")
+	env.duration(&c.ReadTimeout, "READ_TIMEOUT")
+	env.duration(&c.WriteTimeout, "WRITE_TIMEOUT")
+	env.duration(&c.IdleTimeout, "IDLE_TIMEOUT")
+	env.duration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	env.duration(&c.HandlerTimeout, "HANDLER_TIMEOUT")
+	env.duration(&c.WarmupDelay, "WARMUP_DELAY")
+	env.string(&c.TLSCertFile, "TLS_CERT_FILE")
+	env.string(&c.TLSKeyFile, "TLS_KEY_FILE")
+	env.list(&c.AllowedOrigins, "ALLOWED_ORIGINS")
+	env.list(&c.AllowedHosts, "ALLOWED_HOSTS")
+	env.list(&c.BlockedUserAgents, "BLOCKED_USER_AGENTS")
+	env.string(&c.BasePath, "BASE_PATH")
+	env.string(&c.ContentSecurityPolicy, "CONTENT_SECURITY_POLICY")
+	env.string(&c.GreetingsFile, "GREETINGS_FILE")
+	env.duration(&c.GreetingsReloadInterval, "GREETINGS_RELOAD_INTERVAL")
+	env.string(&c.DefaultLocation, "DEFAULT_LOCATION")
+	env.string(&c.OTLPEndpoint, "OTEL_EXPORTER_OTLP_ENDPOINT")
+	env.float(&c.RateLimitPerSecond, "RATE_LIMIT_PER_SECOND")
+	env.int(&c.RateLimitBurst, "RATE_LIMIT_BURST")
+	env.int(&c.CircuitBreakerThreshold, "CIRCUIT_BREAKER_THRESHOLD")
+	env.duration(&c.CircuitBreakerCooldown, "CIRCUIT_BREAKER_COOLDOWN")
+	env.list(&c.TrustedProxies, "TRUSTED_PROXIES")
+	env.int64(&c.MaxBodyBytes, "MAX_BODY_BYTES")
+	env.int(&c.MaxQueryLength, "MAX_QUERY_LENGTH")
+	env.int(&c.MaxQueryParams, "MAX_QUERY_PARAMS")
+	env.int(&c.HistorySize, "HISTORY_SIZE")
+	env.string(&c.AdminToken, "ADMIN_TOKEN")
+	env.duration(&c.StaticCacheMaxAge, "STATIC_CACHE_MAX_AGE")
+	env.bool(&c.EnableH2C, "ENABLE_H2C")
+	env.bool(&c.ForceHTTPS, "FORCE_HTTPS")
+	env.bool(&c.Maintenance, "MAINTENANCE")
+	env.bool(&c.EnableDecorations, "ENABLE_DECORATIONS")
+	env.bool(&c.EnableProfiling, "ENABLE_PROFILING")
+	env.duration(&c.ArtificialLatency, "ARTIFICIAL_LATENCY")
+	env.string(&c.Theme, "THEME")
+	env.bool(&c.DisableKeepAlives, "DISABLE_KEEP_ALIVES")
+	return env.err
+}
+
+// Validate reports the first invalid setting in the config.
+func (c Config) Validate() error {
+	port, err := strconv.Atoi(c.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid PORT %q: must be an integer between 1 and 65535", c.Port)
+	}
+
+	switch c.Env {
+	case EnvLocal, EnvStaging, EnvProduction:
+	default:
+		return fmt.Errorf("invalid ENV %q: must be one of %s, %s, %s", c.Env, EnvLocal, EnvStaging, EnvProduction)
+	}
+
+	if c.RateLimitPerSecond < 0 {
+		return fmt.Errorf("invalid RATE_LIMIT_PER_SECOND %v: must not be negative", c.RateLimitPerSecond)
+	}
+	if c.RateLimitPerSecond > 0 && c.RateLimitBurst < 1 {
+		return fmt.Errorf("invalid RATE_LIMIT_BURST %d: must be at least 1", c.RateLimitBurst)
+	}
+	if c.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("invalid CIRCUIT_BREAKER_THRESHOLD %d: must not be negative", c.CircuitBreakerThreshold)
+	}
+	if c.CircuitBreakerThreshold > 0 && c.CircuitBreakerCooldown <= 0 {
+		return fmt.Errorf("invalid CIRCUIT_BREAKER_COOLDOWN %s: must be positive", c.CircuitBreakerCooldown)
+	}
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("invalid MAX_BODY_BYTES %d: must not be negative", c.MaxBodyBytes)
+	}
+	if c.MaxQueryLength < 0 {
+		return fmt.Errorf("invalid MAX_QUERY_LENGTH %d: must not be negative", c.MaxQueryLength)
+	}
+	if c.MaxQueryParams < 0 {
+		return fmt.Errorf("invalid MAX_QUERY_PARAMS %d: must not be negative", c.MaxQueryParams)
+	}
+	if c.ArtificialLatency < 0 {
+		return fmt.Errorf("invalid ARTIFICIAL_LATENCY %s: must not be negative", c.ArtificialLatency)
+	}
+	if c.ArtificialLatency > 0 && c.Env == EnvProduction {
+		return fmt.Errorf("invalid ARTIFICIAL_LATENCY %s: must not be set in %s", c.ArtificialLatency, EnvProduction)
+	}
+	if c.HistorySize < 0 {
+		return fmt.Errorf("invalid HISTORY_SIZE %d: must not be negative", c.HistorySize)
+	}
+
+	return nil
+}
+
+// redactedValue stands in for secrets in Redacted configs.
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the config safe to log, with the admin token,
+// the TLS key path and any password in the OTLP endpoint masked.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = redactedValue
+	}
+	if c.TLSKeyFile != "" {
+		c.TLSKeyFile = redactedValue
+	}
+	if u, err := url.Parse(c.OTLPEndpoint); err == nil && u.User != nil {
+		c.OTLPEndpoint = u.Redacted()
+	}
+	return c
+}
+
+// plainConfig is Config without its methods, so formatting and logging a
+// redacted copy do not redact it again.
+type plainConfig Config
+
+// String formats the Redacted config.
+func (c Config) String() string {
+	return fmt.Sprintf("%+v", plainConfig(c.Redacted()))
+}
+
+// LogValue logs the Redacted config.
+func (c Config) LogValue() slog.Value {
+	return slog.AnyValue(plainConfig(c.Redacted()))
+}
+
+// MarshalJSON encodes the Redacted config keyed as in a config file, with
+// durations written as strings such as "5s".
+func (c Config) MarshalJSON() ([]byte, error) {
+	redacted := reflect.ValueOf(plainConfig(c.Redacted()))
+	fields := make(map[string]any, redacted.NumField())
+	for _, field := range reflect.VisibleFields(redacted.Type()) {
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		value := redacted.FieldByIndex(field.Index).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
+
+// envReader overwrites config fields with the env vars that are set,
+// keeping the first parse error.
+type envReader struct {
+	err error
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != "" && e.err == nil
+}
+
+func (e *envReader) fail(key, value string, err error) {
+	e.err = fmt.Errorf("invalid %s %q: %w", key, value, err)
+}
+
+func (e *envReader) string(field *string, key string) {
+	if value, ok := e.lookup(key); ok {
+		*field = value
+	}
+}
+
+func (e *envReader) duration(field *time.Duration, key string) {
+	if value, ok := e.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*field = d
+	}
+}
+
+func (e *envReader) float(field *float64, key string) {
+	if value, ok := e.lookup(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*field = f
+	}
+}
+
+func (e *envReader) int(field *int, key string) {
+	if value, ok := e.lookup(key); ok {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*field = i
+	}
+}
+
+func (e *envReader) int64(field *int64, key string) {
+	if value, ok := e.lookup(key); ok {
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*field = i
+	}
+}
+
+func (e *envReader) bool(field *bool, key string) {
+	if value, ok := e.lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*field = b
+	}
+}
+
+func (e *envReader) level(field *slog.Level, key string) {
+	if value, ok := e.lookup(key); ok {
+		if err := field.UnmarshalText([]byte(value)); err != nil {
+			e.fail(key, value, err)
+		}
+	}
+}
+
+// list splits a comma-separated env var, dropping empty items.
+func (e *envReader) list(field *[]string, key string) {
+	if value, ok := e.lookup(key); ok {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field = items
 	}
 }
@@ -1,10 +1,64 @@
 package internal
 
+import (
+	"context"
+	"errors"
+)
+
+// Locations are lower-case names. A hyphen separates a sub-location from
+// its parent, as in "uk-wales", and unknown sub-locations are greeted as
+// their parent.
 const (
-	LocationWorld = "world"
-	LocationUK    = "uk"
+	LocationWorld    = "world"
+	LocationUK       = "uk"
+	LocationScotland = "uk-scotland"
+	LocationWales    = "uk-wales"
+	LocationFrance   = "france"
 )
 
+// ErrUnknownLocation is returned when no greeting is registered for a location.
+var ErrUnknownLocation = errors.New("unknown location")
+
 type Greeter interface {
 	Greet(location string) string
+	GreetE(location string) (string, error)
+	GreetCtx(ctx context.Context, location string) (string, error)
+	GreetName(location, name string) string
+	GreetCount(location string, n int) string
+	GreetLang(location, lang string) string
+	Personalize(location, greeting string, opts GreetOptions) string
+	Locations() []string
+}
+
+// GreetOptions personalises a greeting: Name replaces its place, Lang picks
+// the language of its salutation and a Count above zero greets a group of
+// that size. The zero value leaves a greeting as it is.
+type GreetOptions struct {
+	Name  string
+	Lang  string
+	Count int
+}
+
+// greeterAs returns the first greeter implementing T among g and the
+// greeters it wraps, found by following Unwrap, so decorators such as
+// CachingGreeter do not hide what the greeter beneath them can do.
+func greeterAs[T any](g Greeter) (T, bool) {
+	for g != nil {
+		if found, ok := g.(T); ok {
+			return found, true
+		}
+		wrapper, ok := g.(interface{ Unwrap() Greeter })
+		if !ok {
+			break
+		}
+		g = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// Translator supplies the greeting text for a location, reporting false when
+// it has none.
+type Translator interface {
+	Translate(location string) (string, bool)
 }
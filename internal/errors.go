@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes identify what went wrong in JSON error responses, so clients
+// need not match on messages meant for people.
+const (
+	ErrorCodeBadRequest       = "bad_request"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeUnknownLocation  = "unknown_location"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeBodyTooLarge     = "body_too_large"
+	ErrorCodeQueryTooLong     = "query_too_long"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeMaintenance      = "maintenance"
+	ErrorCodeUnavailable      = "unavailable"
+	ErrorCodeInternal         = "internal"
+	ErrorCodeNotImplemented   = "not_implemented"
+)
+
+// ErrorResponse is the body of every JSON error response.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error with a machine-readable code and a
+// message for people.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeJSONError writes an error as an ErrorResponse.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetail{Code: code, Message: message}})
+}
+
+// writeError writes an error as JSON when the client asks for it, and as
+// plain text otherwise, for middleware that has no pages to render.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if negotiateContentType(r.Header.Get("Accept"), contentTypeText, contentTypeJSON) == contentTypeJSON {
+		writeJSONError(w, status, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
@@ -1,18 +1,556 @@
 package internal
 
-type GreeterService struct{}
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
-func NewGreeter() *GreeterService {
-	return &GreeterService{}
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Hours of the day, in the clock's location, at which time-of-day greetings
+// change. Evening runs until morning starts.
+const (
+	MorningStartHour   = 5
+	AfternoonStartHour = 12
+	EveningStartHour   = 18
+)
+
+// GreeterService greets locations using its Translator, with greetings
+// registered at runtime taking precedence. It is safe to register greetings
+// and aliases while greeting concurrently.
+type GreeterService struct {
+	translator Translator
+	// mu guards greetings, registered, aliases and disabled.
+	mu        sync.RWMutex
+	greetings map[string][]string
+	// registered lists the locations in greetings in the order they were
+	// first registered.
+	registered []string
+	aliases    map[string]string
+	disabled   map[string]bool
+	// catalog holds the salutation GreetLang uses in each of languages,
+	// the first of which matcher picks when no other matches.
+	catalog   catalog.Catalog
+	languages []language.Tag
+	matcher   language.Matcher
+	// decorations map locations to the suffix Greet appends to their
+	// greetings; nil leaves greetings undecorated.
+	decorations map[string]string
+	pick        func(variants []string) string
+	fallback    string
+	clock       func() time.Time
+	tracer      trace.Tracer
+}
+
+// locationLister is implemented by translators that can list the locations
+// they translate.
+type locationLister interface {
+	Locations() []string
+}
+
+type GreeterOption func(*GreeterService)
+
+// WithFallback sets the location Greet uses for unknown locations.
+// An empty location disables the fallback.
+func WithFallback(location string) GreeterOption {
+	return func(g *GreeterService) {
+		g.fallback = location
+	}
+}
+
+// WithTranslator sets the Translator greetings come from. The default is a
+// MemoryTranslator holding the built-in greetings.
+func WithTranslator(translator Translator) GreeterOption {
+	return func(g *GreeterService) {
+		g.translator = translator
+	}
+}
+
+// WithPicker sets how one of a location's greeting variants is chosen. The
+// default picks uniformly at random.
+func WithPicker(pick func(variants []string) string) GreeterOption {
+	return func(g *GreeterService) {
+		g.pick = pick
+	}
+}
+
+// WithTracerProvider sets the provider GreetCtx records spans with. The
+// default records nothing.
+func WithTracerProvider(provider trace.TracerProvider) GreeterOption {
+	return func(g *GreeterService) {
+		g.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// WithClock sets the clock GreetNow reads the time from.
+func WithClock(clock func() time.Time) GreeterOption {
+	return func(g *GreeterService) {
+		g.clock = clock
+	}
+}
+
+// WithDecorations appends decorations[location], such as a flag emoji, to
+// the greetings Greet, GreetE, GreetName, GreetLang and GreetCount return.
+// The time-of-day greetings are left undecorated.
+func WithDecorations(decorations map[string]string) GreeterOption {
+	return func(g *GreeterService) {
+		g.decorations = decorations
+	}
+}
+
+// WithCatalog sets the message catalog GreetLang looks SalutationKey up
+// in, by language, and GreetCount looks CountKey up in. Languages it lacks
+// greet in English when it has English and in its first language otherwise.
+// The default catalog knows English, Spanish, French, German, Italian,
+// Portuguese and Welsh.
+func WithCatalog(cat catalog.Catalog) GreeterOption {
+	return func(g *GreeterService) {
+		g.catalog = cat
+	}
+}
+
+// SalutationKey is the catalog key of the word GreetLang greets with, such
+// as "Hello" in English.
+const SalutationKey = "salutation"
+
+// CountKey is the catalog key GreetCount formats a greeting, its first
+// argument, for a group of its second argument with. Catalogs lacking it
+// format the key itself.
+const CountKey = "%s (x%d)"
+
+// defaultCatalog holds the salutations of the languages GreetLang can greet
+// in out of the box, and the English group greeting GreetCount uses.
+func defaultCatalog() catalog.Catalog {
+	salutations := map[language.Tag]string{
+		language.English:    "Hello",
+		language.Spanish:    "Hola",
+		language.French:     "Bonjour",
+		language.German:     "Hallo",
+		language.Italian:    "Ciao",
+		language.Portuguese: "Olá",
+		language.Make("cy"): "Shwmae",
+	}
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	for tag, salutation := range salutations {
+		builder.SetString(tag, SalutationKey, salutation)
+	}
+	builder.Set(language.English, CountKey,
+		catalog.Var("group", plural.Selectf(2, "%d", "=0", "", "one", "", "other", " (x%[2]d)")),
+		catalog.String("%[1]s${group}"),
+	)
+	return builder
+}
+
+// catalogLanguages returns the languages of cat with English, when cat has
+// it, first so that languages cat lacks are greeted in English.
+func catalogLanguages(cat catalog.Catalog) []language.Tag {
+	languages := cat.Languages()
+	if i := slices.Index(languages, language.English); i > 0 {
+		languages = slices.Insert(slices.Delete(slices.Clone(languages), i, i+1), 0, language.English)
+	}
+	return languages
+}
+
+// defaultDecorations are the flags of the built-in locations.
+func defaultDecorations() map[string]string {
+	return map[string]string{
+		LocationWorld:    "🌍",
+		LocationUK:       "🇬🇧",
+		LocationScotland: "🏴󠁧󠁢󠁳󠁣󠁴󠁿",
+		LocationWales:    "🏴󠁧󠁢󠁷󠁬󠁳󠁿",
+		LocationFrance:   "🇫🇷",
+	}
 }
 
+// defaultAliases are the alternative spellings known out of the box.
+func defaultAliases() map[string]string {
+	return map[string]string{
+		"gb":    LocationUK,
+		"earth": LocationWorld,
+	}
+}
+
+func NewGreeter(opts ...GreeterOption) *GreeterService {
+	g := &GreeterService{
+		translator: NewMemoryTranslator(defaultGreetings()),
+		greetings:  make(map[string][]string),
+		aliases:    defaultAliases(),
+		disabled:   make(map[string]bool),
+		catalog:    defaultCatalog(),
+		pick:       pickRandom,
+		fallback:   LocationWorld,
+		clock:      time.Now,
+		tracer:     noop.NewTracerProvider().Tracer(tracerName),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.languages = catalogLanguages(g.catalog)
+	g.matcher = language.NewMatcher(g.languages)
+	return g
+}
+
+// Register adds or replaces the greeting for location, overriding the
+// translator.
+func (g *GreeterService) Register(location, greeting string) {
+	g.RegisterVariants(location, greeting)
+}
+
+// RegisterAlias makes alias greet as canonical does, replacing any previous
+// target for alias.
+func (g *GreeterService) RegisterAlias(alias, canonical string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.aliases[alias] = canonical
+}
+
+// RegisterVariants adds or replaces the greetings for location with
+// variants, one of which is picked each time the location is greeted.
+// Registering no variants removes the location's registered greetings.
+func (g *GreeterService) RegisterVariants(location string, variants ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(variants) == 0 {
+		delete(g.greetings, location)
+		g.registered = slices.DeleteFunc(g.registered, func(registered string) bool { return registered == location })
+		return
+	}
+	if _, ok := g.greetings[location]; !ok {
+		g.registered = append(g.registered, location)
+	}
+	g.greetings[location] = slices.Clone(variants)
+}
+
+// LocationFor returns the enabled location greeted with message, with or
+// without its decoration, reporting whether there is one. Registered
+// greetings are searched before the translator's, the earliest registered
+// location winning when several share a message, then translated ones in
+// sorted order.
+func (g *GreeterService) LocationFor(message string) (string, bool) {
+	matches := func(location, greeting string) bool {
+		return greeting == message || g.decorate(greeting, location) == message
+	}
+
+	g.mu.RLock()
+	for _, location := range g.registered {
+		if g.disabled[location] {
+			continue
+		}
+		if slices.ContainsFunc(g.greetings[location], func(greeting string) bool { return matches(location, greeting) }) {
+			g.mu.RUnlock()
+			return location, true
+		}
+	}
+	g.mu.RUnlock()
+
+	lister, ok := g.translator.(locationLister)
+	if !ok {
+		return "", false
+	}
+	for _, location := range slices.Sorted(slices.Values(lister.Locations())) {
+		g.mu.RLock()
+		_, overridden := g.greetings[location]
+		disabled := g.disabled[location]
+		g.mu.RUnlock()
+		if overridden || disabled {
+			continue
+		}
+		if greeting, ok := g.translator.Translate(location); ok && matches(location, greeting) {
+			return location, true
+		}
+	}
+	return "", false
+}
+
+// SetEnabled switches greetings for location on or off without removing
+// them. A disabled location is unknown: it is not listed, GreetE reports
+// ErrUnknownLocation and its sub-locations no longer fall back to it.
+func (g *GreeterService) SetEnabled(location string, enabled bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if enabled {
+		delete(g.disabled, location)
+		return
+	}
+	g.disabled[location] = true
+}
+
+// HasGreeting reports whether location has a greeting of its own,
+// registered or translated, whether or not it is enabled. Unlike
+// ResolveLocation it does not follow aliases or parents.
+func (g *GreeterService) HasGreeting(location string) bool {
+	g.mu.RLock()
+	_, registered := g.greetings[location]
+	g.mu.RUnlock()
+	if registered {
+		return true
+	}
+	_, translated := g.translator.Translate(location)
+	return translated
+}
+
+// AliasOf returns the location alias greets as, reporting whether alias is
+// an alias at all.
+func (g *GreeterService) AliasOf(alias string) (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	canonical, ok := g.aliases[alias]
+	return canonical, ok
+}
+
+func pickRandom(variants []string) string {
+	return variants[rand.IntN(len(variants))]
+}
+
+// GreetCtx is GreetE for callers with a context, returning the context's
+// error when it is already done. It records a span carrying the location.
+func (g *GreeterService) GreetCtx(ctx context.Context, location string) (string, error) {
+	_, span := g.tracer.Start(ctx, "GreeterService.GreetCtx",
+		trace.WithAttributes(attribute.String("greeting.location", location)),
+	)
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	greeting, err := g.GreetE(location)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return greeting, err
+}
+
+// Locations returns the enabled registered locations, and those the
+// translator can list, in sorted order.
+func (g *GreeterService) Locations() []string {
+	var translated []string
+	if lister, ok := g.translator.(locationLister); ok {
+		translated = lister.Locations()
+	}
+
+	g.mu.RLock()
+	locations := append(slices.Collect(maps.Keys(g.greetings)), translated...)
+	locations = slices.DeleteFunc(locations, func(location string) bool { return g.disabled[location] })
+	g.mu.RUnlock()
+	slices.Sort(locations)
+	return slices.Compact(locations)
+}
+
+// Greet returns the greeting for location, falling back to the configured
+// fallback location when it is unknown. Prefer GreetE when the caller needs
+// to know.
 func (g *GreeterService) Greet(location string) string {
-	switch location {
-	case LocationUK:
-		return "Hello, UK!"
-	case LocationWorld:
-		return "Hello, World!"
+	return g.decorate(g.greetPlain(location))
+}
+
+// greetPlain is Greet without decoration, also returning the location
+// whose greeting was used.
+func (g *GreeterService) greetPlain(location string) (message, resolved string) {
+	message, resolved, err := g.resolve(location)
+	if err != nil && g.fallback != "" {
+		message, resolved, _ = g.resolve(g.fallback)
+	}
+	return message, resolved
+}
+
+// GreetE returns the greeting for location, or for the location it is an
+// alias of, or ErrUnknownLocation. An unknown sub-location such as
+// "uk-cornwall" is greeted as its nearest known parent.
+func (g *GreeterService) GreetE(location string) (string, error) {
+	greeting, resolved, err := g.resolve(location)
+	if err != nil {
+		return "", err
+	}
+	return g.decorate(greeting, resolved), nil
+}
+
+// ResolveLocation returns the known location greeted for location, after
+// following aliases and parents, reporting whether there is one, so
+// "gb" and "uk-cornwall" both resolve to "uk".
+func (g *GreeterService) ResolveLocation(location string) (string, bool) {
+	_, resolved, err := g.resolve(location)
+	return resolved, err == nil
+}
+
+// resolve returns the undecorated greeting for location and the location,
+// after following aliases and parents, it belongs to.
+func (g *GreeterService) resolve(location string) (greeting, resolved string, err error) {
+	g.mu.RLock()
+	if canonical, ok := g.aliases[location]; ok {
+		location = canonical
+	}
+	g.mu.RUnlock()
+	for {
+		if greeting, ok := g.lookup(location); ok {
+			return greeting, location, nil
+		}
+		parent, _, ok := cutLast(location, "-")
+		if !ok {
+			return "", "", ErrUnknownLocation
+		}
+		location = parent
+	}
+}
+
+// decorate appends location's decoration, if any, to greeting.
+func (g *GreeterService) decorate(greeting, location string) string {
+	if decoration, ok := g.decorations[location]; ok && greeting != "" {
+		return greeting + " " + decoration
+	}
+	return greeting
+}
+
+// lookup returns the registered or translated greeting for location alone.
+func (g *GreeterService) lookup(location string) (string, bool) {
+	g.mu.RLock()
+	variants, ok := g.greetings[location]
+	disabled := g.disabled[location]
+	g.mu.RUnlock()
+	if disabled {
+		return "", false
+	}
+	if ok {
+		if len(variants) == 1 {
+			return variants[0], true
+		}
+		return g.pick(variants), true
+	}
+	return g.translator.Translate(location)
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// GreetCount greets a group of n with the catalog's CountKey message in
+// its first language, such as "Hello, World! (x3)" in English. Groups of
+// one or fewer get the singular form.
+func (g *GreeterService) GreetCount(location string, n int) string {
+	return g.countGreeting(g.Greet(location), max(n, 0))
+}
+
+// GreetName greets name using the salutation of location's greeting, such
+// as "Hello, Alice!". An empty name greets the location itself.
+func (g *GreeterService) GreetName(location, name string) string {
+	greeting, resolved := g.greetPlain(location)
+	return g.personalize(greeting, resolved, GreetOptions{Name: name})
+}
+
+// GreetLang greets location's place with the salutation of the catalog
+// language best matching the BCP 47 tag lang, such as "Hola, World!" for
+// "es". A regional tag such as "es-MX" uses its base language, unknown or
+// malformed tags greet in English and an empty lang greets as Greet does.
+func (g *GreeterService) GreetLang(location, lang string) string {
+	greeting, resolved := g.greetPlain(location)
+	return g.personalize(greeting, resolved, GreetOptions{Lang: lang})
+}
+
+// Personalize rebuilds greeting, as GreetE or GreetCtx returned it for
+// location, for opts without looking location up again, so a request
+// greeting through a CachingGreeter or CircuitBreakerGreeter only calls
+// through it once and keeps the variant it was given.
+func (g *GreeterService) Personalize(location, greeting string, opts GreetOptions) string {
+	resolved, _ := g.ResolveLocation(location)
+	if decoration, ok := g.decorations[resolved]; ok {
+		greeting = strings.TrimSuffix(greeting, " "+decoration)
+	}
+	return g.personalize(greeting, resolved, opts)
+}
+
+// personalize applies opts to the undecorated greeting of resolved, then
+// decorates it.
+func (g *GreeterService) personalize(greeting, resolved string, opts GreetOptions) string {
+	if opts.Name != "" || opts.Lang != "" {
+		salutation, place := splitGreeting(greeting)
+		if opts.Lang != "" {
+			salutation = g.printer(opts.Lang).Sprintf(SalutationKey)
+		}
+		if opts.Name != "" {
+			place = opts.Name
+		}
+		greeting = salutation + "!"
+		if place != "" {
+			greeting = fmt.Sprintf("%s, %s!", salutation, place)
+		}
+	}
+	greeting = g.decorate(greeting, resolved)
+	if opts.Count > 0 {
+		greeting = g.countGreeting(greeting, opts.Count)
+	}
+	return greeting
+}
+
+// countGreeting formats greeting for a group of n with CountKey.
+func (g *GreeterService) countGreeting(greeting string, n int) string {
+	return g.printer("").Sprintf(CountKey, greeting, n)
+}
+
+// printer prints catalog messages in the catalog language best matching
+// the tag lang, or its first language for an empty lang.
+func (g *GreeterService) printer(lang string) *message.Printer {
+	return message.NewPrinter(g.languageFor(lang), message.Catalog(g.catalog))
+}
+
+// languageFor returns the catalog language best matching the tag lang.
+func (g *GreeterService) languageFor(lang string) language.Tag {
+	if len(g.languages) == 0 {
+		return language.English
+	}
+	// language.Make ignores errors, leaving tags it cannot parse undefined,
+	// which the matcher answers with the default language.
+	_, i, _ := g.matcher.Match(language.Make(lang))
+	return g.languages[i]
+}
+
+// GreetNow returns the time-of-day greeting for location at the current time.
+func (g *GreeterService) GreetNow(location string) string {
+	return g.GreetAtTime(location, g.clock())
+}
+
+// GreetAtTime returns a greeting for location suited to the time of day at t,
+// such as "Good morning, UK!".
+func (g *GreeterService) GreetAtTime(location string, t time.Time) string {
+	greeting, _ := g.greetPlain(location)
+	_, place := splitGreeting(greeting)
+	salutation := timeOfDaySalutation(t.Hour())
+	if place == "" {
+		return salutation + "!"
+	}
+	return fmt.Sprintf("%s, %s!", salutation, place)
+}
+
+func timeOfDaySalutation(hour int) string {
+	switch {
+	case hour >= MorningStartHour && hour < AfternoonStartHour:
+		return "Good morning"
+	case hour >= AfternoonStartHour && hour < EveningStartHour:
+		return "Good afternoon"
 	default:
-		return "Hello, World!"
+		return "Good evening"
 	}
 }
+
+// splitGreeting splits a greeting of the form "Salutation, Place!" into its
+// parts. Greetings without a place return an empty place.
+func splitGreeting(greeting string) (salutation, place string) {
+	salutation, place, _ = strings.Cut(strings.TrimSuffix(greeting, "!"), ", ")
+	return salutation, place
+}
@@ -0,0 +1,116 @@
+// Package greetertest provides a Greeter test double for handler and server
+// tests.
+package greetertest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"propertyProject/internal"
+)
+
+// FakeGreeter greets from a fixed location→greeting map and records every
+// location it is asked to greet. It is safe for concurrent use.
+type FakeGreeter struct {
+	greetings map[string]string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+var _ internal.Greeter = (*FakeGreeter)(nil)
+
+// NewFakeGreeter returns a FakeGreeter knowing a copy of greetings.
+func NewFakeGreeter(greetings map[string]string) *FakeGreeter {
+	return &FakeGreeter{greetings: maps.Clone(greetings)}
+}
+
+// Calls returns the locations greeted so far, in order.
+func (f *FakeGreeter) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *FakeGreeter) record(location string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, location)
+}
+
+func (f *FakeGreeter) lookup(location string) (string, error) {
+	greeting, ok := f.greetings[location]
+	if !ok {
+		return "", internal.ErrUnknownLocation
+	}
+	return greeting, nil
+}
+
+func (f *FakeGreeter) Greet(location string) string {
+	f.record(location)
+	greeting, _ := f.lookup(location)
+	return greeting
+}
+
+func (f *FakeGreeter) GreetE(location string) (string, error) {
+	f.record(location)
+	return f.lookup(location)
+}
+
+func (f *FakeGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	f.record(location)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return f.lookup(location)
+}
+
+// GreetName replaces everything after the first ", " in location's greeting
+// with name, returning "" for unknown locations.
+func (f *FakeGreeter) GreetName(location, name string) string {
+	f.record(location)
+	greeting, err := f.lookup(location)
+	if err != nil {
+		return ""
+	}
+	salutation, _, _ := strings.Cut(greeting, ", ")
+	return salutation + ", " + name + "!"
+}
+
+// GreetCount appends " (xN)" to location's greeting for groups of more
+// than one.
+func (f *FakeGreeter) GreetCount(location string, n int) string {
+	greeting := f.Greet(location)
+	if n <= 1 || greeting == "" {
+		return greeting
+	}
+	return fmt.Sprintf("%s (x%d)", greeting, n)
+}
+
+// GreetLang returns location's greeting whatever the language.
+func (f *FakeGreeter) GreetLang(location, lang string) string {
+	return f.Greet(location)
+}
+
+// Personalize puts opts.Name in place of everything after the first ", "
+// in greeting and appends " (xN)" for counts over one, ignoring opts.Lang,
+// without greeting again.
+func (f *FakeGreeter) Personalize(location, greeting string, opts internal.GreetOptions) string {
+	if opts.Name != "" && greeting != "" {
+		salutation, _, _ := strings.Cut(greeting, ", ")
+		greeting = salutation + ", " + opts.Name + "!"
+	}
+	if opts.Count > 1 && greeting != "" {
+		greeting = fmt.Sprintf("%s (x%d)", greeting, opts.Count)
+	}
+	return greeting
+}
+
+// Locations returns the known locations in sorted order.
+func (f *FakeGreeter) Locations() []string {
+	return slices.Sorted(maps.Keys(f.greetings))
+}
@@ -1,46 +1,645 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
 	"net/http"
-	"path/filepath"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"propertyProject"
 )
 
 type Handler struct {
-	greeter Greeter
+	greeter   Greeter
+	logger    *slog.Logger
+	assets    fs.FS
+	theme     string
+	static    http.Handler
+	favicon   []byte
+	index     *template.Template
+	greeting  *template.Template
+	errorPage *template.Template
+	build     BuildInfo
+	env       string
+	profiling bool
+	stats     *Stats
+	history   *History
+	ready     atomic.Bool
+	// maintenance makes greeting routes answer 503 Service Unavailable.
+	maintenance atomic.Bool
+
+	adminToken string
+	shutdown   func()
+	// config returns the live config /admin/config reports, when set.
+	config func() Config
+
+	staticCacheMaxAge time.Duration
+	basePath          string
 }
 
-func NewHandler(greeter Greeter) *Handler {
-	return &Handler{greeter: greeter}
+type HandlerOption func(*Handler)
+
+// WithAssets sets the filesystem templates and static files are read from.
+// It must contain the templates and static directories.
+func WithAssets(assets fs.FS) HandlerOption {
+	return func(h *Handler) {
+		h.assets = assets
+	}
 }
 
-func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles(filepath.Join("templates", "index.html"))
+// themesDir holds a directory of templates for each theme.
+const themesDir = "templates/themes"
+
+// WithTheme renders pages with the templates of the named theme, such as
+// "dark" for templates/themes/dark. Templates the theme lacks come from the
+// default templates, which an empty name uses throughout.
+func WithTheme(name string) HandlerOption {
+	return func(h *Handler) {
+		h.theme = name
+	}
+}
+
+// WithLogger sets the logger handler errors are reported to.
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// WithBuildInfo sets the build /version reports. It defaults to
+// CurrentBuild.
+func WithBuildInfo(build BuildInfo) HandlerOption {
+	return func(h *Handler) {
+		h.build = build
+	}
+}
+
+// WithEnv sets the environment the handler runs in, one of EnvLocal,
+// EnvStaging and EnvProduction. Only EnvLocal pages carry a DEV banner and
+// only EnvLocal error responses the details of internal errors; by default
+// they are hidden.
+func WithEnv(env string) HandlerOption {
+	return func(h *Handler) {
+		h.env = env
+	}
+}
+
+// WithProfiling mounts the net/http/pprof handlers under /debug/pprof
+// whatever the environment. EnvLocal handlers mount them regardless.
+func WithProfiling(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.profiling = enabled
+	}
+}
+
+// WithConfigSource lets /admin/config report the config config returns,
+// which should be the one currently in effect.
+func WithConfigSource(config func() Config) HandlerOption {
+	return func(h *Handler) {
+		h.config = config
+	}
+}
+
+// WithShutdown enables /admin/shutdown, which calls shutdown for requests
+// whose X-Admin-Token header matches token. The token authorises the other
+// admin endpoints too. An empty token leaves them rejecting every request.
+func WithShutdown(token string, shutdown func()) HandlerOption {
+	return func(h *Handler) {
+		h.adminToken = token
+		h.shutdown = shutdown
+	}
+}
+
+// WithHistorySize sets how many recent greetings /admin/history reports.
+// It defaults to DefaultHistorySize; zero keeps none.
+func WithHistorySize(size int) HandlerOption {
+	return func(h *Handler) {
+		h.history = NewHistory(size)
+	}
+}
+
+// WithStaticCacheMaxAge sets how long clients may cache static files. Zero,
+// the default, sends no Cache-Control header.
+func WithStaticCacheMaxAge(maxAge time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.staticCacheMaxAge = maxAge
+	}
+}
+
+// WithBasePath mounts every route under basePath, such as "/greeter", and
+// prefixes the links in pages with it. The default is the root.
+func WithBasePath(basePath string) HandlerOption {
+	return func(h *Handler) {
+		h.basePath = normalizeBasePath(basePath)
+	}
+}
+
+// normalizeBasePath gives basePath a leading slash and no trailing one, or
+// returns "" for the root.
+func normalizeBasePath(basePath string) string {
+	if trimmed := strings.Trim(basePath, "/"); trimmed != "" {
+		return "/" + trimmed
+	}
+	return ""
+}
+
+// NewHandler parses the page templates up front so a missing or broken
+// template fails at startup rather than on the first request. Assets default
+// to the ones embedded in the binary and errors go to the default logger.
+func NewHandler(greeter Greeter, opts ...HandlerOption) (*Handler, error) {
+	h := &Handler{
+		greeter: greeter,
+		logger:  slog.Default(),
+		assets:  propertyproject.Assets,
+		build:   CurrentBuild(),
+		stats:   NewStats(),
+		history: NewHistory(DefaultHistorySize),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.theme != "" {
+		if strings.Contains(h.theme, "/") || !fs.ValidPath(h.theme) {
+			return nil, fmt.Errorf("invalid theme %q: must be a directory name", h.theme)
+		}
+		if info, err := fs.Stat(h.assets, path.Join(themesDir, h.theme)); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid theme %q: no such directory in %s", h.theme, themesDir)
+		}
+	}
+
+	var err error
+	h.index, err = template.ParseFS(h.assets, h.templatePath("index.html"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing index template: %w", err)
+	}
+
+	h.greeting, err = template.ParseFS(h.assets, h.templatePath("partials/greeting.html"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, fmt.Errorf("parsing greeting template: %w", err)
+	}
+
+	h.errorPage, err = template.ParseFS(h.assets, h.templatePath("error.html"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing error template: %w", err)
+	}
+
+	static, err := fs.Sub(h.assets, "static")
+	if err != nil {
+		return nil, fmt.Errorf("opening static assets: %w", err)
+	}
+	// Embedded assets change only with the binary, so they are as new as
+	// the process serving them.
+	h.static = explicitContentTypes(http.FileServerFS(modTimeFS{FS: static, modTime: time.Now()}))
+
+	h.favicon, err = fs.ReadFile(h.assets, faviconPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading favicon: %w", err)
+	}
+
+	return h, nil
+}
+
+// templatePath returns where the template name, such as "index.html", is
+// read from: the handler's theme when it has the template, and the default
+// templates otherwise.
+func (h *Handler) templatePath(name string) string {
+	if h.theme != "" {
+		themed := path.Join(themesDir, h.theme, name)
+		if _, err := fs.Stat(h.assets, themed); err == nil {
+			return themed
+		}
+	}
+	return path.Join("templates", name)
+}
+
+// faviconPath is where the favicon sits in the assets. Assets without one
+// serve none.
+const faviconPath = "static/favicon.ico"
+
+// FaviconHandler serves the assets' favicon, or 204 No Content when they
+// have none, so browsers asking for it do not fill the logs with 404s.
+func (h *Handler) FaviconHandler(w http.ResponseWriter, r *http.Request) {
+	if h.favicon == nil {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	tmpl.Execute(w, nil)
+	w.Header().Set("Content-Type", staticContentTypes[".ico"])
+	http.ServeContent(w, r, "favicon.ico", time.Time{}, bytes.NewReader(h.favicon))
+}
+
+// StaticHandler serves the static directory of the handler's assets.
+func (h *Handler) StaticHandler() http.Handler {
+	return h.static
+}
+
+// IndexHandler renders the landing page with a link to each location's
+// greeting.
+func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.execute(w, r, http.StatusOK, h.index, map[string]any{
+		"BasePath":  h.basePath,
+		"Env":       h.env,
+		"Locations": h.greeter.Locations(),
+	})
+	if err != nil {
+		h.renderError(w, r, http.StatusInternalServerError, ErrorCodeInternal, "rendering the page failed")
+	}
 }
 
 func (h *Handler) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
-	message := h.greeter.Greet(LocationWorld)
-	h.renderGreeting(w, message)
+	h.greet(w, r, LocationWorld)
 }
 
 func (h *Handler) HelloUKHandler(w http.ResponseWriter, r *http.Request) {
-	message := h.greeter.Greet(LocationUK)
-	h.renderGreeting(w, message)
+	h.greet(w, r, LocationUK)
+}
+
+func (h *Handler) HelloFranceHandler(w http.ResponseWriter, r *http.Request) {
+	h.greet(w, r, LocationFrance)
+}
+
+// LocationsHandler lists the locations that can be greeted.
+func (h *Handler) LocationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	json.NewEncoder(w).Encode(map[string][]string{"locations": h.greeter.Locations()})
 }
 
-func (h *Handler) renderGreeting(w http.ResponseWriter, message string) {
-	tmpl, err := template.ParseFiles(filepath.Join("templates", "partials", "greeting.html"))
+// HelloHandler greets the location in the path, or the location best
+// matching the Accept-Language header when the path has none.
+func (h *Handler) HelloHandler(w http.ResponseWriter, r *http.Request) {
+	location, ok := mux.Vars(r)["location"]
+	if !ok {
+		location = LocationForLanguage(r.Header.Get("Accept-Language"))
+	}
+	h.greet(w, r, location)
+}
+
+// maintenanceMessage explains the 503 greeting routes answer in
+// maintenance mode.
+const maintenanceMessage = "greetings are unavailable during maintenance; please try again shortly"
+
+func (h *Handler) greet(w http.ResponseWriter, r *http.Request, location string) {
+	if h.maintenance.Load() {
+		h.renderError(w, r, http.StatusServiceUnavailable, ErrorCodeMaintenance, maintenanceMessage)
+		return
+	}
+
+	count := 0
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			h.renderError(w, r, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("invalid count %q: must be a non-negative integer", raw))
+			return
+		}
+		count = n
+	}
+
+	message, err := h.greeter.GreetCtx(r.Context(), location)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if status, code, message := h.greetingFailure(w, r, location, err); status != 0 {
+			h.renderError(w, r, status, code, message)
+		}
 		return
 	}
-	tmpl.Execute(w, map[string]string{"Message": message})
+	// The name, lang and count parameters combine, so ?name=Alice&lang=es&count=3
+	// greets "Hola, Alice! (x3)".
+	opts := GreetOptions{
+		Name:  strings.TrimSpace(r.URL.Query().Get("name")),
+		Lang:  r.URL.Query().Get("lang"),
+		Count: count,
+	}
+	// Personalising the greeting already fetched, rather than greeting again,
+	// keeps the request to one call through any cache or circuit breaker.
+	message = h.greeter.Personalize(location, message, opts)
+	h.recordGreeting(r, location)
+	h.renderGreeting(w, r, message)
+}
+
+// recordGreeting notes a greeting of location served for r in the
+// metrics, stats and history under the location it resolved to, so aliases
+// and made-up sub-locations cannot grow them without bound.
+func (h *Handler) recordGreeting(r *http.Request, location string) {
+	if resolver, ok := greeterAs[locationResolver](h.greeter); ok {
+		resolved, ok := resolver.ResolveLocation(location)
+		if !ok {
+			resolved = unknownLocationLabel
+		}
+		location = resolved
+	}
+	labelGreeting(r.Context(), location)
+	h.stats.RecordGreeting(location)
+	h.history.Record(location, time.Now())
+}
+
+// greetingFailure maps a greeting error to the status, error code and
+// message to respond with, setting any headers they need on w, or returns
+// a zero status when the client has gone away and there is no one to
+// respond to.
+func (h *Handler) greetingFailure(w http.ResponseWriter, r *http.Request, location string, err error) (int, string, string) {
+	var circuitOpen *CircuitOpenError
+	switch {
+	case errors.Is(err, ErrUnknownLocation):
+		labelGreeting(r.Context(), unknownLocationLabel)
+		return http.StatusNotFound, ErrorCodeUnknownLocation, err.Error()
+	case errors.As(err, &circuitOpen):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(circuitOpen.RetryAfter.Seconds()))))
+		return http.StatusServiceUnavailable, ErrorCodeUnavailable, "greetings are temporarily unavailable"
+	case errors.Is(err, context.Canceled):
+		return 0, "", ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, ErrorCodeTimeout, "the greeting took too long"
+	default:
+		h.logger.ErrorContext(r.Context(), "greeting failed",
+			slog.String("location", location),
+			slog.Any("error", err),
+		)
+		return http.StatusInternalServerError, ErrorCodeInternal, h.internalErrorMessage(err)
+	}
+}
+
+// internalErrorMessage describes err to clients in full locally, and
+// generically elsewhere so internal details do not leak.
+func (h *Handler) internalErrorMessage(err error) string {
+	if h.env == EnvLocal {
+		return err.Error()
+	}
+	return "internal server error"
+}
+
+// jsonpCallbackPattern matches the dotted JavaScript identifiers accepted
+// as JSONP callbacks, so a callback cannot smuggle in script of its own.
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]{0,63}(\.[A-Za-z_$][A-Za-z0-9_$]{0,63}){0,3}$`)
+
+// APIGreetingHandler greets the location in the path as JSON, whatever the
+// client accepts, or as JSONP when a callback query parameter is given.
+func (h *Handler) APIGreetingHandler(w http.ResponseWriter, r *http.Request) {
+	callback := r.URL.Query().Get("callback")
+	if callback != "" && !jsonpCallbackPattern.MatchString(callback) {
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("invalid callback %q: must be a JavaScript identifier", callback))
+		return
+	}
+	if h.maintenance.Load() {
+		writeJSONError(w, http.StatusServiceUnavailable, ErrorCodeMaintenance, maintenanceMessage)
+		return
+	}
+
+	location := mux.Vars(r)["location"]
+	message, err := h.greeter.GreetCtx(r.Context(), location)
+	if err != nil {
+		if status, code, message := h.greetingFailure(w, r, location, err); status != 0 {
+			writeJSONError(w, status, code, message)
+		}
+		return
+	}
+
+	h.recordGreeting(r, location)
+	body, _ := json.Marshal(map[string]string{"location": location, "message": message})
+	if callback == "" {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.Write(append(body, '\n'))
+		return
+	}
+
+	// The leading comment stops the response being read as anything but
+	// script, such as a Flash file.
+	w.Header().Set("Content-Type", "application/javascript")
+	fmt.Fprintf(w, "/**/%s(%s);\n", callback, body)
+}
+
+// APIGreetingsHandler lists every location's greeting as JSON, in the
+// order of the greeter's Locations.
+func (h *Handler) APIGreetingsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance.Load() {
+		writeJSONError(w, http.StatusServiceUnavailable, ErrorCodeMaintenance, maintenanceMessage)
+		return
+	}
+
+	if wantsStream(r) {
+		h.streamGreetings(w, r)
+		return
+	}
+
+	greetings := []apiGreeting{}
+	for _, location := range h.greeter.Locations() {
+		message, err := h.greeter.GreetCtx(r.Context(), location)
+		if errors.Is(err, ErrUnknownLocation) {
+			// The location was removed since it was listed.
+			continue
+		}
+		if err != nil {
+			if status, code, message := h.greetingFailure(w, r, location, err); status != 0 {
+				writeJSONError(w, status, code, message)
+			}
+			return
+		}
+		greetings = append(greetings, apiGreeting{Location: location, Message: message})
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	json.NewEncoder(w).Encode(map[string][]apiGreeting{"greetings": greetings})
+}
+
+// apiGreeting is a greeting as the API reports it.
+type apiGreeting struct {
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// streamGreetings writes every location's greeting as a line of JSON,
+// flushing each as soon as it is made rather than holding them all. A
+// failure after the first line ends the stream with a line holding the
+// error, as the status has already been sent.
+func (h *Handler) streamGreetings(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", contentTypeNDJSON)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+
+	for _, location := range h.greeter.Locations() {
+		message, err := h.greeter.GreetCtx(r.Context(), location)
+		if errors.Is(err, ErrUnknownLocation) {
+			// The location was removed since it was listed.
+			continue
+		}
+		if err != nil {
+			status, code, message := h.greetingFailure(w, r, location, err)
+			switch {
+			case status == 0:
+			case started:
+				encoder.Encode(ErrorResponse{Error: ErrorDetail{Code: code, Message: message}})
+			default:
+				writeJSONError(w, status, code, message)
+			}
+			return
+		}
+
+		start()
+		if err := encoder.Encode(apiGreeting{Location: location, Message: message}); err != nil {
+			return
+		}
+		// Writers that cannot flush send the stream as they buffer it.
+		controller.Flush()
+	}
+	start()
+}
+
+// openAPIPath is where the OpenAPI description of the API sits in the
+// assets.
+const openAPIPath = "static/openapi.json"
+
+// OpenAPIHandler serves the OpenAPI description of the API, pointed at the
+// base path when there is one.
+func (h *Handler) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := fs.ReadFile(h.assets, openAPIPath)
+	if err == nil && h.basePath != "" {
+		var doc map[string]any
+		if err = json.Unmarshal(spec, &doc); err == nil {
+			doc["servers"] = []map[string]string{{"url": h.basePath}}
+			spec, err = json.Marshal(doc)
+		}
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "reading OpenAPI description failed", slog.Any("error", err))
+		writeJSONError(w, http.StatusInternalServerError, ErrorCodeInternal, "the API description is unavailable")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Write(spec)
+}
+
+// renderGreeting writes the greeting as JSON or plain text when the client
+// asks for it, and as the HTML partial otherwise, answering conditional
+// requests with 304 Not Modified.
+func (h *Handler) renderGreeting(w http.ResponseWriter, r *http.Request, message string) {
+	var body bytes.Buffer
+	var contentType string
+	switch negotiateContentType(r.Header.Get("Accept"), contentTypeHTML, contentTypeJSON, contentTypeText) {
+	case contentTypeJSON:
+		contentType = contentTypeJSON
+		json.NewEncoder(&body).Encode(map[string]string{"message": message})
+	case contentTypeText:
+		contentType = "text/plain; charset=utf-8"
+		body.WriteString(message + "\n")
+	default:
+		contentType = "text/html; charset=utf-8"
+		if err := h.render(r, &body, h.greeting, map[string]string{"Env": h.env, "Message": message}); err != nil {
+			h.renderError(w, r, http.StatusInternalServerError, ErrorCodeInternal, "rendering the greeting failed")
+			return
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	writeWithETag(w, r, contentType, body.Bytes())
+}
+
+// writeWithETag writes body tagged with a hash of its content, or just 304
+// Not Modified when the request's If-None-Match already has that tag.
+func writeWithETag(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison RFC 9110 specifies for it.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotFoundHandler renders the page for paths no route matches.
+func (h *Handler) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	h.renderError(w, r, http.StatusNotFound, ErrorCodeNotFound, "The page you were looking for does not exist.")
+}
+
+// MethodNotAllowedHandler renders the page for routes requested with an
+// unsupported method.
+func (h *Handler) MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	h.renderError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, fmt.Sprintf("%s is not supported for %s.", r.Method, r.URL.Path))
+}
+
+// renderError writes an error as JSON when the client asks for it, and as
+// the HTML error page otherwise.
+func (h *Handler) renderError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if negotiateContentType(r.Header.Get("Accept"), contentTypeHTML, contentTypeJSON) == contentTypeJSON {
+		writeJSONError(w, status, code, message)
+		return
+	}
+
+	err := h.execute(w, r, status, h.errorPage, map[string]any{
+		"BasePath": h.basePath,
+		"Status":   status,
+		"Title":    http.StatusText(status),
+		"Message":  message,
+	})
+	if err != nil {
+		// The error page itself is broken, so fall back to plain text.
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// execute writes tmpl as an HTML page with status once it has rendered in
+// full, so a template failing part way sends nothing and the caller can
+// still respond with an error.
+func (h *Handler) execute(w http.ResponseWriter, r *http.Request, status int, tmpl *template.Template, data any) error {
+	var body bytes.Buffer
+	if err := h.render(r, &body, tmpl, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+	return nil
+}
+
+// render executes tmpl into body, logging any failure.
+func (h *Handler) render(r *http.Request, body *bytes.Buffer, tmpl *template.Template, data any) error {
+	if err := tmpl.Execute(body, data); err != nil {
+		h.logger.ErrorContext(r.Context(), "rendering template failed",
+			slog.String("template", tmpl.Name()),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	return nil
 }
 
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -48,3 +647,244 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
+
+// HealthzHandler reports whether the greeting template can still be read
+// from the assets and rendered, catching packaging mistakes the shallow
+// HealthHandler cannot.
+func (h *Handler) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.checkTemplates(); err != nil {
+		h.logger.ErrorContext(r.Context(), "health check failed", slog.Any("error", err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "degraded"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// checkTemplates parses the greeting template afresh and renders it.
+func (h *Handler) checkTemplates() error {
+	tmpl, err := template.ParseFS(h.assets, h.templatePath("partials/greeting.html"))
+	if err != nil {
+		return fmt.Errorf("parsing greeting template: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, map[string]string{"Message": "Hello, World!"}); err != nil {
+		return fmt.Errorf("rendering greeting template: %w", err)
+	}
+	return nil
+}
+
+// LivezHandler reports the process is up.
+func (h *Handler) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyzHandler reports whether the server is ready to take traffic.
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unavailable"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// StatsHandler reports how many greetings have been served per location
+// since the handler was created.
+func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]map[string]uint64{"greetings": h.stats.Greetings()})
+}
+
+// VersionHandler reports which build is running.
+func (h *Handler) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.build)
+}
+
+// AdminTokenHeader carries the token authorising admin endpoints.
+const AdminTokenHeader = "X-Admin-Token"
+
+// ShutdownHandler starts a graceful shutdown for callers presenting the
+// admin token.
+func (h *Handler) ShutdownHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shutdown == nil || !h.authorized(r) {
+		h.renderError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "a valid admin token is required")
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "shutdown requested")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "shutting down"})
+	h.shutdown()
+}
+
+// registrar is implemented by greeters that greetings can be registered
+// with at runtime, such as GreeterService.
+type registrar interface {
+	Register(location, greeting string)
+	ResolveLocation(location string) (string, bool)
+	HasGreeting(location string) bool
+	AliasOf(alias string) (string, bool)
+}
+
+// cacheInvalidator is implemented by greeters caching greetings by known
+// location, such as CachingGreeter.
+type cacheInvalidator interface {
+	Invalidate(location string)
+}
+
+// locationResolver is implemented by greeters that can name the known
+// location a requested one resolves to, such as GreeterService.
+type locationResolver interface {
+	ResolveLocation(location string) (string, bool)
+}
+
+// locationSlugPattern matches the lowercase, hyphen-separated locations
+// greetings can be registered for, such as "spain" or "uk-cornwall".
+var locationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// AddGreetingHandler registers a greeting for callers presenting the admin
+// token, taking a body such as {"location": "spain", "message": "Hola,
+// España!"}. Locations that can already be greeted are rejected with 409
+// Conflict unless the overwrite query parameter is true.
+func (h *Handler) AddGreetingHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.renderError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "a valid admin token is required")
+		return
+	}
+	registry, ok := greeterAs[registrar](h.greeter)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, ErrorCodeNotImplemented, "this greeter does not support registering greetings")
+		return
+	}
+
+	var body struct {
+		Location string `json:"location"`
+		Message  string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, ErrorCodeBodyTooLarge, fmt.Sprintf("invalid greeting: body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("invalid greeting: %v", err))
+		return
+	}
+	if !locationSlugPattern.MatchString(body.Location) {
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("invalid location %q: must be a lowercase slug such as \"spain\"", body.Location))
+		return
+	}
+	if strings.TrimSpace(body.Message) == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, "invalid greeting: message must not be empty")
+		return
+	}
+
+	if canonical, ok := registry.AliasOf(body.Location); ok {
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("invalid location %q: it is an alias of %q, register the greeting for %q instead", body.Location, canonical, canonical))
+		return
+	}
+
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+	// ResolveLocation finds the enabled greetings; disabled ones are only
+	// found by looking the location up exactly.
+	resolved, ok := registry.ResolveLocation(body.Location)
+	known := (ok && resolved == body.Location) || registry.HasGreeting(body.Location)
+	if !overwrite && known {
+		writeJSONError(w, http.StatusConflict, ErrorCodeConflict, fmt.Sprintf("location %q already has a greeting; pass overwrite=true to replace it", body.Location))
+		return
+	}
+
+	registry.Register(body.Location, body.Message)
+	if cache, ok := greeterAs[cacheInvalidator](h.greeter); ok {
+		cache.Invalidate(body.Location)
+	}
+	h.logger.InfoContext(r.Context(), "greeting registered",
+		slog.String("location", body.Location),
+		slog.Bool("overwrite", overwrite),
+	)
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"location": body.Location, "message": body.Message})
+}
+
+// MaintenanceHandler switches maintenance mode on or off for callers
+// presenting the admin token, taking a body such as {"enabled": true}.
+func (h *Handler) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.renderError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "a valid admin token is required")
+		return
+	}
+
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrorCodeBadRequest, `the body must be {"enabled": true} or {"enabled": false}`)
+		return
+	}
+
+	h.SetMaintenance(*body.Enabled)
+	h.logger.InfoContext(r.Context(), "maintenance mode changed", slog.Bool("enabled", *body.Enabled))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"maintenance": *body.Enabled})
+}
+
+// HistoryHandler reports the most recent greetings served, newest first,
+// to requests carrying the admin token.
+func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.renderError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "a valid admin token is required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]HistoryEntry{"greetings": h.history.Recent()})
+}
+
+// ConfigHandler reports the live config, secrets redacted, to requests
+// carrying the admin token. Handlers without a config source answer 501 Not
+// Implemented.
+func (h *Handler) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.renderError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "a valid admin token is required")
+		return
+	}
+	if h.config == nil {
+		writeJSONError(w, http.StatusNotImplemented, ErrorCodeNotImplemented, "this server does not report its config")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.config())
+}
+
+// authorized reports whether r carries the admin token. No request is
+// authorized when the token is empty.
+func (h *Handler) authorized(r *http.Request) bool {
+	token := r.Header.Get(AdminTokenHeader)
+	return h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+// SetMaintenance switches maintenance mode, in which greeting routes answer
+// 503 Service Unavailable while health and admin endpoints keep working.
+func (h *Handler) SetMaintenance(enabled bool) {
+	h.maintenance.Store(enabled)
+}
+
+// SetReady marks whether the server is ready to take traffic.
+func (h *Handler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
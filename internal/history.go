@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is how many greetings a handler's History keeps unless
+// configured otherwise.
+const DefaultHistorySize = 100
+
+// HistoryEntry records one greeting served.
+type HistoryEntry struct {
+	Location string    `json:"location"`
+	Time     time.Time `json:"time"`
+}
+
+// History keeps the most recent greetings served in a ring buffer, the
+// oldest overwritten once it is full. It is safe for concurrent use.
+type History struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	// next is where the next entry goes.
+	next int
+	full bool
+}
+
+// NewHistory keeps the last size greetings. A size of zero or less keeps
+// none.
+func NewHistory(size int) *History {
+	return &History{entries: make([]HistoryEntry, max(size, 0))}
+}
+
+// Record adds a greeting of location served at t.
+func (h *History) Record(location string, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = HistoryEntry{Location: location, Time: t}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns a snapshot of the kept greetings, newest first.
+func (h *History) Recent() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.next
+	if h.full {
+		n = len(h.entries)
+	}
+	recent := make([]HistoryEntry, 0, n)
+	for i := range n {
+		recent = append(recent, h.entries[(h.next-1-i+len(h.entries))%len(h.entries)])
+	}
+	return recent
+}
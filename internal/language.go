@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// languageLocations maps language tags to the location whose greeting suits
+// speakers of that language.
+var languageLocations = map[string]string{
+	"en-gb": LocationUK,
+	"fr":    LocationFrance,
+	"en":    LocationWorld,
+}
+
+// LocationForLanguage picks the location best matching an Accept-Language
+// header, falling back to World when nothing matches.
+func LocationForLanguage(acceptLanguage string) string {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if location, ok := languageLocations[tag]; ok {
+			return location
+		}
+		if base, _, found := strings.Cut(tag, "-"); found {
+			if location, ok := languageLocations[base]; ok {
+				return location
+			}
+		}
+	}
+	return LocationWorld
+}
+
+// parseAcceptLanguage returns the lower-cased language tags in the header
+// ordered by descending quality. Tags with q=0 or an invalid q are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
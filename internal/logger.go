@@ -0,0 +1,11 @@
+package internal
+
+import (
+	"log/slog"
+	"os"
+)
+
+// NewLogger returns a JSON logger writing to stderr at the given level.
+func NewLogger(level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
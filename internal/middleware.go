@@ -0,0 +1,548 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Middleware wraps a handler with behaviour of its own.
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes middlewares into one, the first outermost, so requests
+// pass through them in the order given.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for _, middleware := range slices.Backward(middlewares) {
+			next = middleware(next)
+		}
+		return next
+	}
+}
+
+// responseWriter records the status code written by the wrapped handler.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RequestIDHeader carries the ID correlating a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware reuses the incoming X-Request-ID or generates a UUID,
+// stores it in the request context and echoes it in the response.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID set by RequestIDMiddleware, or
+// an empty string when there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short IDs of letters, digits and "-_." so client
+// input cannot inject anything into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// LoggingMiddleware logs the method, path, status, duration and request ID
+// of every request.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+
+			next.ServeHTTP(rw, r)
+
+			logger.InfoContext(r.Context(), "request handled",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.status),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+			)
+		})
+	}
+}
+
+type requestStartKey struct{}
+
+// requestStart returns when ServerTimingMiddleware saw the request, or now
+// when it did not, so inner middleware times requests from the same moment.
+func requestStart(ctx context.Context) time.Time {
+	if start, ok := ctx.Value(requestStartKey{}).(time.Time); ok {
+		return start
+	}
+	return time.Now()
+}
+
+// ServerTimingMiddleware reports how long the server took to start its
+// response in a Server-Timing header, such as "app;dur=12.345" in
+// milliseconds, for browser developer tools to show.
+func ServerTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := context.WithValue(r.Context(), requestStartKey{}, start)
+		next.ServeHTTP(&serverTimingWriter{ResponseWriter: w, start: start}, r.WithContext(ctx))
+	})
+}
+
+// serverTimingWriter adds the Server-Timing header just before the headers
+// are sent.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	wroteHeader bool
+}
+
+func (w *serverTimingWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= http.StatusOK {
+		w.wroteHeader = true
+		elapsed := float64(time.Since(w.start)) / float64(time.Millisecond)
+		w.Header().Set("Server-Timing", fmt.Sprintf("app;dur=%.3f", elapsed))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// internalErrorPage is the HTML body written when a handler panics, with
+// the base path its stylesheet is served under.
+const internalErrorPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Internal Server Error - Property Project</title>
+    <link rel="stylesheet" href="%s/static/css/main.css">
+</head>
+<body>
+    <h1>500 Internal Server Error</h1>
+
+    <p>Something went wrong on our side.</p>
+</body>
+</html>
+`
+
+// RecoverMiddleware turns a handler panic into a 500 response and logs the
+// panic with its stack trace. The error page links the stylesheet served
+// under basePath, such as "/greeter".
+func RecoverMiddleware(logger *slog.Logger, basePath string) Middleware {
+	page := fmt.Sprintf(internalErrorPage, html.EscapeString(normalizeBasePath(basePath)))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := newResponseWriter(w)
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				logger.ErrorContext(r.Context(), "handler panicked",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Any("panic", recovered),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				if rw.wroteHeader {
+					return
+				}
+				if negotiateContentType(r.Header.Get("Accept"), contentTypeHTML, contentTypeJSON) == contentTypeJSON {
+					writeJSONError(w, http.StatusInternalServerError, ErrorCodeInternal, "internal server error")
+					return
+				}
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, page)
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// HTTPSRedirectMiddleware redirects requests a proxy forwarded as plain
+// HTTP, per their X-Forwarded-Proto header, to the same URL over HTTPS:
+// permanently with 301 for GET and HEAD, and with 308 for other methods so
+// they are retried as they were. Requests without the header pass through,
+// so probes reaching the server directly still work.
+func HTTPSRedirectMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if r.TLS != nil || !strings.EqualFold(strings.TrimSpace(proto), "http") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		target := url.URL{Scheme: "https", Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), status)
+	})
+}
+
+// AllowedHostsMiddleware rejects requests whose Host header, ignoring any
+// port and case, is not one of hosts with 400 Bad Request, so links built
+// from the Host cannot be pointed elsewhere. No hosts allows any Host.
+func AllowedHostsMiddleware(hosts []string) Middleware {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+			if !allowed[strings.ToLower(host)] {
+				writeError(w, r, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("host %q is not allowed", r.Host))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BlockUserAgentsMiddleware refuses requests whose User-Agent contains any
+// of blocked, ignoring case, with 403 Forbidden. No substrings block
+// nothing.
+func BlockUserAgentsMiddleware(blocked []string) Middleware {
+	var substrings []string
+	for _, s := range blocked {
+		if s != "" {
+			substrings = append(substrings, strings.ToLower(s))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(substrings) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent := strings.ToLower(r.UserAgent())
+			if slices.ContainsFunc(substrings, func(s string) bool { return strings.Contains(userAgent, s) }) {
+				writeError(w, r, http.StatusForbidden, ErrorCodeForbidden, http.StatusText(http.StatusForbidden))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsAllowedMethods are the methods browsers may use cross-origin.
+const corsAllowedMethods = "GET, HEAD, OPTIONS"
+
+// CORSMiddleware allows cross-origin requests from the given origins, or
+// from any origin when they include "*", and answers preflight requests.
+// Unless any origin is allowed, every response carries Vary: Origin, as
+// whether it allows its origin depends on the request's, so caches do not
+// serve one origin's response to another.
+func CORSMiddleware(allowedOrigins []string) Middleware {
+	allowAny := slices.Contains(allowedOrigins, "*")
+	checksOrigin := len(allowedOrigins) > 0 && !allowAny
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && (allowAny || slices.Contains(allowedOrigins, origin))
+
+			if checksOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+			if allowed {
+				if allowAny {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+			}
+
+			preflight := r.Method == http.MethodOptions && origin != "" &&
+				r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// hstsHeaderValue asks browsers to use HTTPS for a year, subdomains included.
+const hstsHeaderValue = "max-age=31536000; includeSubDomains"
+
+// SecurityHeadersMiddleware sets headers hardening responses against
+// sniffing and framing, plus Content-Security-Policy when csp is non-empty
+// and Strict-Transport-Security when hsts is true. Only enable hsts when the
+// server is served over TLS.
+func SecurityHeadersMiddleware(csp string, hsts bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", "DENY")
+			if csp != "" {
+				header.Set("Content-Security-Policy", csp)
+			}
+			if hsts {
+				header.Set("Strict-Transport-Security", hstsHeaderValue)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MaxBodyBytesMiddleware rejects request bodies over limit bytes with 413
+// Request Entity Too Large. Bodies declaring a larger Content-Length are
+// rejected up front; reading past the limit of any other body fails with
+// *http.MaxBytesError, which handlers should answer with a 413.
+func MaxBodyBytesMiddleware(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeError(w, r, http.StatusRequestEntityTooLarge, ErrorCodeBodyTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// QueryLimitsMiddleware rejects query strings longer than maxLength bytes
+// with 414 URI Too Long, and those with more than maxParams parameters with
+// 400 Bad Request. A zero limit is not enforced.
+func QueryLimitsMiddleware(maxLength, maxParams int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.RawQuery
+			if maxLength > 0 && len(query) > maxLength {
+				writeError(w, r, http.StatusRequestURITooLong, ErrorCodeQueryTooLong, fmt.Sprintf("query string longer than %d bytes", maxLength))
+				return
+			}
+			if maxParams > 0 && countQueryParams(query) > maxParams {
+				writeError(w, r, http.StatusBadRequest, ErrorCodeBadRequest, fmt.Sprintf("more than %d query parameters", maxParams))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// countQueryParams counts the non-empty &-separated parameters in query,
+// repeated keys included, without parsing them.
+func countQueryParams(query string) int {
+	n := 0
+	for param := range strings.SplitSeq(query, "&") {
+		if param != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// LatencyMiddleware delays each request by delay before handling it, to
+// test how clients and proxies cope with a slow server. Requests whose
+// context ends while waiting are not handled.
+func LatencyMiddleware(delay time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				next.ServeHTTP(w, r)
+			case <-r.Context().Done():
+			}
+		})
+	}
+}
+
+// CacheControlMiddleware lets clients and shared caches reuse responses for
+// maxAge.
+func CacheControlMiddleware(maxAge time.Duration) Middleware {
+	value := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestDeadlineHeader carries the time by which a caller needs its
+// response, so work it would give up on is not done.
+const RequestDeadlineHeader = "X-Request-Deadline"
+
+// DeadlineMiddleware gives each request's context the deadline in its
+// X-Request-Deadline header, either an RFC 3339 time or a number of seconds
+// from now, so handlers greeting with GreetCtx stop once the caller has
+// given up. Deadlines already past are answered with 504 Gateway Timeout,
+// malformed ones with 400 Bad Request; requests without one are untouched.
+// A deadline only ever shortens a request: TimeoutMiddleware, chained
+// after it, still bounds a deadline later than the handler timeout.
+func DeadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(RequestDeadlineHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		deadline, err := parseRequestDeadline(value, time.Now())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeBadRequest, err.Error())
+			return
+		}
+		if !time.Now().Before(deadline) {
+			writeError(w, r, http.StatusGatewayTimeout, ErrorCodeTimeout, "the request deadline has already passed")
+			return
+		}
+
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseRequestDeadline reads an X-Request-Deadline value as an RFC 3339
+// time, or as seconds after now.
+func parseRequestDeadline(value string, now time.Time) (time.Time, error) {
+	if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return deadline, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	// The negated comparison also rejects NaN.
+	if err != nil || !(math.Abs(seconds) < math.MaxInt64/float64(time.Second)) {
+		return time.Time{}, fmt.Errorf("invalid %s %q: must be an RFC 3339 time or a number of seconds", RequestDeadlineHeader, value)
+	}
+	return now.Add(time.Duration(seconds * float64(time.Second))), nil
+}
+
+// timeoutMessage is the body sent when a handler runs out of time.
+const timeoutMessage = "The server took too long to respond. Please try again."
+
+// TimeoutMiddleware answers 503 Service Unavailable when a handler takes
+// longer than timeout, cancelling the request's context. Handlers should
+// stop work once it is done. Responses are buffered to make that possible,
+// so requests for streams only have their context cancelled. Requests for
+// paths under any of exempt, such as profiles that run as long as asked,
+// are not timed at all.
+func TimeoutMiddleware(timeout time.Duration, exempt ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		buffered := http.TimeoutHandler(next, timeout, timeoutMessage)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.ContainsFunc(exempt, func(prefix string) bool { return hasPathPrefix(r.URL.Path, prefix) }) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !wantsStream(r) {
+				buffered.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// hasPathPrefix reports whether path is prefix or lies beneath it, so
+// "/debug/pprof" covers "/debug/pprof/profile" but not "/debug/pprofile".
+func hasPathPrefix(path, prefix string) bool {
+	rest, ok := strings.CutPrefix(path, prefix)
+	return ok && (rest == "" || rest[0] == '/')
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeHTML = "text/html"
+	contentTypeJSON = "application/json"
+	// contentTypeNDJSON is newline-delimited JSON, one value per line.
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeText   = "text/plain"
+)
+
+// negotiateContentType picks the offer the Accept header prefers most.
+// Earlier offers win ties, so the first offer is the default when the header
+// is missing, malformed or matches nothing.
+func negotiateContentType(accept string, offers ...string) string {
+	best, bestQuality := offers[0], 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQuality {
+			best, bestQuality = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the Accept header assigns to mediaType,
+// taken from the most specific matching range.
+func acceptQuality(accept, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	offerType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case mediaRange == mediaType:
+			s = 2
+		case mediaRange == offerType+"/*":
+			s = 1
+		case mediaRange == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
+
+// wantsStream reports whether r prefers its response as a stream of
+// newline-delimited JSON to a single JSON document.
+func wantsStream(r *http.Request) bool {
+	return negotiateContentType(r.Header.Get("Accept"), contentTypeJSON, contentTypeNDJSON) == contentTypeNDJSON
+}
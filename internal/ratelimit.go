@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimiterPruneInterval is how often idle client limiters are pruned.
+	rateLimiterPruneInterval = time.Minute
+	// rateLimiterIdleTimeout is how long a client may be idle before its
+	// limiter is discarded.
+	rateLimiterIdleTimeout = 3 * time.Minute
+)
+
+// RateLimiter applies a token bucket per client IP.
+type RateLimiter struct {
+	limit          rate.Limit
+	burst          int
+	trustedProxies []net.IPNet
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastPrune time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows each client perSecond requests on average, with
+// bursts of up to burst requests. Clients are told apart by ClientIP, which
+// believes X-Forwarded-For only from trustedProxies.
+func NewRateLimiter(perSecond float64, burst int, trustedProxies []net.IPNet) *RateLimiter {
+	return &RateLimiter{
+		limit:          rate.Limit(perSecond),
+		burst:          burst,
+		trustedProxies: trustedProxies,
+		clients:        make(map[string]*clientLimiter),
+		lastPrune:      time.Now(),
+	}
+}
+
+// Middleware rejects requests over the client's limit with 429 and a
+// Retry-After header.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.reserve(ClientIP(r, l.trustedProxies), time.Now()); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, r, http.StatusTooManyRequests, ErrorCodeRateLimited, http.StatusText(http.StatusTooManyRequests))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reserve takes a token for ip, returning how long the client must wait
+// before retrying when none is available.
+func (l *RateLimiter) reserve(ip string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > rateLimiterPruneInterval {
+		for key, client := range l.clients {
+			if now.Sub(client.lastSeen) > rateLimiterIdleTimeout {
+				delete(l.clients, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return rateLimiterIdleTimeout
+	}
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		reservation.CancelAt(now)
+		return wait
+	}
+	return 0
+}
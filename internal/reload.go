@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+)
+
+// Reload applies the reloadable subset of cfg - log level, allowed origins
+// and hosts, blocked user agents and rate limits - to the running server.
+// Changes to any other setting need a restart and are ignored with a
+// warning. Rate limiter state starts afresh.
+func (s *Server) Reload(cfg Config) {
+	current := *s.cfg.Load()
+
+	next := current
+	next.LogLevel = cfg.LogLevel
+	next.AllowedOrigins = cfg.AllowedOrigins
+	next.AllowedHosts = cfg.AllowedHosts
+	next.BlockedUserAgents = cfg.BlockedUserAgents
+	next.RateLimitPerSecond = cfg.RateLimitPerSecond
+	next.RateLimitBurst = cfg.RateLimitBurst
+
+	if ignored := changedFields(next, cfg); len(ignored) > 0 {
+		s.logger.Warn("ignoring config changes that need a restart", slog.Any("fields", ignored))
+	}
+
+	s.apply(next)
+	s.logger.Info("config reloaded",
+		slog.String("log_level", next.LogLevel.String()),
+		slog.Any("allowed_origins", next.AllowedOrigins),
+		slog.Any("allowed_hosts", next.AllowedHosts),
+		slog.Any("blocked_user_agents", next.BlockedUserAgents),
+		slog.Float64("rate_limit_per_second", next.RateLimitPerSecond),
+		slog.Int("rate_limit_burst", next.RateLimitBurst),
+	)
+}
+
+// WatchReload reloads the config with load each time a signal arrives,
+// typically SIGHUP, until ctx is cancelled. A config that fails to load is
+// logged and the running config kept.
+func (s *Server) WatchReload(ctx context.Context, signals <-chan os.Signal, load func() (Config, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			cfg, err := load()
+			if err != nil {
+				s.logger.Error("config reload failed", slog.Any("error", err))
+				continue
+			}
+			s.Reload(cfg)
+		}
+	}
+}
+
+// changedFields names the Config fields that differ between a and b.
+func changedFields(a, b Config) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var changed []string
+	for i := range va.NumField() {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryingGreeter retries another Greeter's failed greetings, waiting a
+// base delay before the second attempt and twice as long before each one
+// after, up to a number of attempts. Unknown locations, open circuits and
+// done contexts are not retried, and a context ending while waiting ends
+// the retries with its error. Only GreetE and GreetCtx are retried.
+type RetryingGreeter struct {
+	Greeter
+	attempts  int
+	baseDelay time.Duration
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+type RetryOption func(*RetryingGreeter)
+
+// WithRetrySleep sets how the greeter waits between attempts. sleep must
+// return early with ctx's error once ctx is done.
+func WithRetrySleep(sleep func(ctx context.Context, d time.Duration) error) RetryOption {
+	return func(r *RetryingGreeter) {
+		r.sleep = sleep
+	}
+}
+
+// NewRetryingGreeter tries next up to attempts times, backing off from
+// baseDelay. Fewer than one attempt means one.
+func NewRetryingGreeter(next Greeter, attempts int, baseDelay time.Duration, opts ...RetryOption) *RetryingGreeter {
+	r := &RetryingGreeter{
+		Greeter:   next,
+		attempts:  max(attempts, 1),
+		baseDelay: baseDelay,
+		sleep:     sleepCtx,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Unwrap returns the greeter r wraps.
+func (r *RetryingGreeter) Unwrap() Greeter {
+	return r.Greeter
+}
+
+func (r *RetryingGreeter) GreetE(location string) (string, error) {
+	return r.GreetCtx(context.Background(), location)
+}
+
+func (r *RetryingGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	delay := r.baseDelay
+	for attempt := 1; ; attempt++ {
+		greeting, err := r.Greeter.GreetCtx(ctx, location)
+		if err == nil || attempt == r.attempts || !retryable(err) {
+			return greeting, err
+		}
+		if err := r.sleep(ctx, delay); err != nil {
+			return "", err
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether trying again could make err go away.
+func retryable(err error) bool {
+	return !errors.Is(err, ErrUnknownLocation) &&
+		!errors.Is(err, ErrCircuitOpen) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// sleepCtx waits for d, or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
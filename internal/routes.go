@@ -1,20 +1,129 @@
 package internal
 
 import (
+	"context"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(handler *Handler) *mux.Router {
-	r := mux.NewRouter()
+// NewRouter routes to handler's endpoints, all mounted under its base path.
+// Pages and greetings answer HEAD as well as GET; net/http drops the body.
+// The pprof handlers are only mounted for EnvLocal or profiling handlers.
+func NewRouter(handler *Handler, metrics *Metrics) *mux.Router {
+	root := mux.NewRouter()
+	root.NotFoundHandler = redirectTrailingSlash(root, http.HandlerFunc(handler.NotFoundHandler))
+	root.MethodNotAllowedHandler = http.HandlerFunc(handler.MethodNotAllowedHandler)
+	root.Use(metrics.InFlightMiddleware, metrics.Middleware)
+
+	r := root
+	if handler.basePath != "" {
+		r = root.PathPrefix(handler.basePath).Subrouter()
+	}
 
 	r.HandleFunc("/health", handler.HealthHandler).Methods("GET")
-	r.HandleFunc("/", handler.IndexHandler).Methods("GET")
-	r.HandleFunc("/hello-world", handler.HelloWorldHandler).Methods("GET")
-	r.HandleFunc("/hello-uk", handler.HelloUKHandler).Methods("GET")
+	r.HandleFunc("/healthz", handler.HealthzHandler).Methods("GET")
+	r.HandleFunc("/livez", handler.LivezHandler).Methods("GET")
+	r.HandleFunc("/readyz", handler.ReadyzHandler).Methods("GET")
+	r.HandleFunc("/stats", handler.StatsHandler).Methods("GET")
+	r.HandleFunc("/version", handler.VersionHandler).Methods("GET")
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/openapi.json", handler.OpenAPIHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/", handler.IndexHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/locations", handler.LocationsHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/hello", handler.HelloHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/hello/{location}", handler.HelloHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/hello-world", handler.HelloWorldHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/hello-uk", handler.HelloUKHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/hello-france", handler.HelloFranceHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/admin/shutdown", handler.ShutdownHandler).Methods("POST")
+	r.HandleFunc("/admin/maintenance", handler.MaintenanceHandler).Methods("POST")
+	r.HandleFunc("/admin/greetings", handler.AddGreetingHandler).Methods("POST")
+	r.HandleFunc("/admin/history", handler.HistoryHandler).Methods("GET")
+	r.HandleFunc("/admin/config", handler.ConfigHandler).Methods("GET")
+
+	if handler.profiling || handler.env == EnvLocal {
+		mountProfiling(r, handler.basePath)
+	}
+
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/greetings", handler.APIGreetingsHandler).Methods("GET", "HEAD")
+	api.HandleFunc("/greetings/{location}", handler.APIGreetingHandler).Methods("GET", "HEAD")
+
+	static := handler.StaticHandler()
+	favicon := http.Handler(http.HandlerFunc(handler.FaviconHandler))
+	if handler.staticCacheMaxAge > 0 {
+		static = CacheControlMiddleware(handler.staticCacheMaxAge)(static)
+		favicon = CacheControlMiddleware(handler.staticCacheMaxAge)(favicon)
+	}
+	r.Handle("/favicon.ico", favicon).Methods("GET", "HEAD")
+	r.PathPrefix("/static/").Handler(http.StripPrefix(handler.basePath+"/static/", static))
+
+	return root
+}
+
+// profilingPath is where the pprof handlers are mounted, under the base path.
+const profilingPath = "/debug/pprof"
+
+// profilingWriteSlack is how long past a profile's duration its response
+// may take to write.
+const profilingWriteSlack = 10 * time.Second
+
+// mountProfiling serves net/http/pprof under /debug/pprof. The handlers
+// expect their standard paths, so basePath is stripped first.
+func mountProfiling(r *mux.Router, basePath string) {
+	profiling := r.PathPrefix(profilingPath).Subrouter()
+	profiling.Handle("/cmdline", http.StripPrefix(basePath, http.HandlerFunc(pprof.Cmdline))).Methods("GET")
+	profiling.Handle("/profile", http.StripPrefix(basePath, extendWriteDeadline(30, pprof.Profile))).Methods("GET")
+	profiling.Handle("/symbol", http.StripPrefix(basePath, http.HandlerFunc(pprof.Symbol))).Methods("GET", "POST")
+	profiling.Handle("/trace", http.StripPrefix(basePath, extendWriteDeadline(1, pprof.Trace))).Methods("GET")
+	profiling.PathPrefix("/").Handler(http.StripPrefix(basePath, http.HandlerFunc(pprof.Index))).Methods("GET")
+}
+
+// extendWriteDeadline lets next, a pprof handler collecting for the
+// seconds query parameter or defaultSeconds, outlast the server's
+// WriteTimeout by pushing the connection's write deadline past the
+// collection. pprof refuses durations beyond the WriteTimeout it finds on
+// the request's server, so that is hidden from it too.
+func extendWriteDeadline(defaultSeconds float64, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+		if err != nil || seconds <= 0 {
+			seconds = defaultSeconds
+		}
+		duration := time.Duration(seconds * float64(time.Second))
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(duration + profilingWriteSlack))
+		ctx := context.WithValue(r.Context(), http.ServerContextKey, nil)
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// redirectTrailingSlash permanently redirects paths that only miss a route
+// because of a trailing slash, such as /hello-uk/, to the route, handing
+// every other request to notFound.
+func redirectTrailingSlash(router *mux.Router, notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trimmed := strings.TrimRight(r.URL.Path, "/")
+		if trimmed == "" || trimmed == r.URL.Path {
+			notFound.ServeHTTP(w, r)
+			return
+		}
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+		candidate := r.Clone(r.Context())
+		candidate.URL.Path = trimmed
+		candidate.URL.RawPath = ""
+		var match mux.RouteMatch
+		if !router.Match(candidate, &match) || match.MatchErr != nil {
+			notFound.ServeHTTP(w, r)
+			return
+		}
 
-	return r
+		target := url.URL{Path: trimmed, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
 }
@@ -1,25 +1,495 @@
 package internal
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
-	addr   string
-	router http.Handler
+	*http.Server
+	handler         *Handler
+	router          http.Handler
+	logger          *slog.Logger
+	logLevel        *slog.LevelVar
+	shutdownTimeout time.Duration
+	shutdownTracing func(context.Context) error
+	trustedProxies  []net.IPNet
+	// unixSocket is the path Listen binds instead of Addr, when set.
+	unixSocket string
+
+	// warmupHooks and warmupDelay are run and waited out by Warmup.
+	warmupHooks []func(context.Context) error
+	warmupDelay time.Duration
+
+	// greetingsFile is watched for changes while the server runs, when set.
+	greetingsFile           *FileTranslator
+	greetingsReloadInterval time.Duration
+
+	// shutdownRequested is closed by RequestShutdown.
+	shutdownRequested chan struct{}
+	shutdownOnce      sync.Once
+
+	// activeRequests counts requests being served, reported while draining.
+	activeRequests atomic.Int64
+
+	// cfg and chain change together on Reload.
+	cfg   atomic.Pointer[Config]
+	chain atomic.Pointer[http.Handler]
+}
+
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	logger      *slog.Logger
+	greeter     Greeter
+	handler     *Handler
+	handlerOpts []HandlerOption
+	middlewares []Middleware
+	warmupHooks []func(context.Context) error
+}
+
+// WithServerLogger sets the logger the server and its handler report to.
+// The default is JSON on stderr at the config's log level.
+func WithServerLogger(logger *slog.Logger) ServerOption {
+	return func(o *serverOptions) {
+		o.logger = logger
+	}
+}
+
+// WithGreeter sets the greeter the default handler serves. It is ignored
+// when WithHandler is also given.
+func WithGreeter(greeter Greeter) ServerOption {
+	return func(o *serverOptions) {
+		o.greeter = greeter
+	}
+}
+
+// WithHandler sets the handler the server routes to in place of one built
+// from the config.
+func WithHandler(handler *Handler) ServerOption {
+	return func(o *serverOptions) {
+		o.handler = handler
+	}
+}
+
+// WithHandlerOptions passes opts on to the default handler. They are
+// ignored when WithHandler is also given.
+func WithHandlerOptions(opts ...HandlerOption) ServerOption {
+	return func(o *serverOptions) {
+		o.handlerOpts = append(o.handlerOpts, opts...)
+	}
+}
+
+// WithMiddleware wraps the router in middlewares, the first outermost,
+// inside the server's own middleware.
+func WithMiddleware(middlewares ...Middleware) ServerOption {
+	return func(o *serverOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithWarmup adds hook to the steps Warmup runs, such as priming a cache,
+// after its own.
+func WithWarmup(hook func(ctx context.Context) error) ServerOption {
+	return func(o *serverOptions) {
+		o.warmupHooks = append(o.warmupHooks, hook)
+	}
+}
+
+// NewServer builds the server for cfg. Without options it greets from the
+// config's greetings and logs JSON to stderr at cfg.LogLevel, which Reload
+// can change later.
+func NewServer(cfg Config, opts ...ServerOption) (*Server, error) {
+	var o serverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	logger := o.logger
+	if logger == nil {
+		logger = NewLogger(logLevel)
+	}
+
+	tracerProvider, shutdownTracing, err := NewTracerProvider(context.Background(), cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{shutdownRequested: make(chan struct{})}
+
+	handler := o.handler
+	if handler == nil {
+		greeter := o.greeter
+		if greeter == nil {
+			greeter, err = s.newConfiguredGreeter(cfg, tracerProvider)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cfg.CircuitBreakerThreshold > 0 {
+			greeter = NewCircuitBreakerGreeter(greeter, cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown)
+		}
+		handlerOpts := append([]HandlerOption{
+			WithLogger(logger),
+			WithEnv(cfg.Env),
+			WithProfiling(cfg.EnableProfiling),
+			WithShutdown(cfg.AdminToken, s.RequestShutdown),
+			WithStaticCacheMaxAge(cfg.StaticCacheMaxAge),
+			WithBasePath(cfg.BasePath),
+			WithHistorySize(cfg.HistorySize),
+			WithTheme(cfg.Theme),
+			WithConfigSource(func() Config { return *s.cfg.Load() }),
+		}, o.handlerOpts...)
+		handler, err = NewHandler(greeter, handlerOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Maintenance {
+		handler.SetMaintenance(true)
+	}
+	metrics := NewMetrics()
+	router := Chain(o.middlewares...)(NewRouter(handler, metrics))
+
+	trustedProxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := loadTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Server = &http.Server{
+		Addr:         net.JoinHostPort(cfg.Host, cfg.Port),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		TLSConfig:    tlsConfig,
+	}
+	// Shutting down closes connections after their response regardless.
+	if cfg.DisableKeepAlives {
+		s.Server.SetKeepAlivesEnabled(false)
+	}
+	// net/http serves h2c itself since Go 1.24, replacing x/net/http2/h2c.
+	if cfg.EnableH2C {
+		s.Server.Protocols = new(http.Protocols)
+		s.Server.Protocols.SetHTTP1(true)
+		s.Server.Protocols.SetHTTP2(true)
+		s.Server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	s.handler = handler
+	s.router = GzipMiddleware(DefaultGzipMinSize)(router)
+	s.logger = logger
+	s.logLevel = logLevel
+	s.shutdownTimeout = cfg.ShutdownTimeout
+	s.shutdownTracing = shutdownTracing
+	s.trustedProxies = trustedProxies
+	s.warmupHooks = o.warmupHooks
+	s.warmupDelay = cfg.WarmupDelay
+	s.unixSocket = cfg.UnixSocket
+	s.apply(cfg)
+	s.Server.Handler = otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.activeRequests.Add(1)
+		defer s.activeRequests.Add(-1)
+		(*s.chain.Load()).ServeHTTP(w, r)
+	}), "http.server",
+		otelhttp.WithTracerProvider(tracerProvider),
+		otelhttp.WithPropagators(propagator),
+	)
+	return s, nil
+}
+
+// newConfiguredGreeter builds the greeter for cfg, reading its greetings
+// file if it has one, and checks it can greet the default location.
+func (s *Server) newConfiguredGreeter(cfg Config, tracerProvider trace.TracerProvider) (*GreeterService, error) {
+	opts := []GreeterOption{WithTracerProvider(tracerProvider)}
+	if cfg.GreetingsFile != "" {
+		translator, err := NewFileTranslator(cfg.GreetingsFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTranslator(translator))
+		if cfg.GreetingsReloadInterval > 0 {
+			s.greetingsFile = translator
+			s.greetingsReloadInterval = cfg.GreetingsReloadInterval
+		}
+	}
+	if cfg.DefaultLocation != "" {
+		opts = append(opts, WithFallback(cfg.DefaultLocation))
+	}
+	if cfg.EnableDecorations {
+		opts = append(opts, WithDecorations(defaultDecorations()))
+	}
+
+	greeter := NewGreeter(opts...)
+	if cfg.DefaultLocation != "" {
+		if _, err := greeter.GreetE(cfg.DefaultLocation); err != nil {
+			return nil, fmt.Errorf("invalid DEFAULT_LOCATION %q: %w", cfg.DefaultLocation, err)
+		}
+	}
+	return greeter, nil
+}
+
+// Validate builds everything the server for cfg needs, parsing templates
+// and loading greetings and TLS files, without listening, and reports the
+// first problem.
+func Validate(cfg Config, opts ...ServerOption) error {
+	s, err := NewServer(cfg, opts...)
+	if err != nil {
+		return err
+	}
+	return s.shutdownTracing(context.Background())
+}
+
+// Logger returns the logger the server reports to.
+func (s *Server) Logger() *slog.Logger {
+	return s.logger
+}
+
+// apply makes cfg the live config, rebuilding the middleware that depends on
+// it around the router.
+func (s *Server) apply(cfg Config) {
+	s.logLevel.Set(cfg.LogLevel)
+
+	middlewares := []Middleware{
+		RecoverMiddleware(s.logger, cfg.BasePath),
+		RequestIDMiddleware,
+		ServerTimingMiddleware,
+		LoggingMiddleware(s.logger),
+	}
+	if cfg.ForceHTTPS {
+		middlewares = append(middlewares, HTTPSRedirectMiddleware)
+	}
+	middlewares = append(middlewares,
+		SecurityHeadersMiddleware(cfg.ContentSecurityPolicy, s.TLSConfig != nil || cfg.ForceHTTPS),
+		AllowedHostsMiddleware(cfg.AllowedHosts),
+		BlockUserAgentsMiddleware(cfg.BlockedUserAgents),
+		CORSMiddleware(cfg.AllowedOrigins),
+		DeadlineMiddleware,
+	)
+	if cfg.MaxQueryLength > 0 || cfg.MaxQueryParams > 0 {
+		middlewares = append(middlewares, QueryLimitsMiddleware(cfg.MaxQueryLength, cfg.MaxQueryParams))
+	}
+	if cfg.HandlerTimeout > 0 {
+		middlewares = append(middlewares, TimeoutMiddleware(cfg.HandlerTimeout, normalizeBasePath(cfg.BasePath)+profilingPath))
+	}
+	if cfg.MaxBodyBytes > 0 {
+		middlewares = append(middlewares, MaxBodyBytesMiddleware(cfg.MaxBodyBytes))
+	}
+	if cfg.RateLimitPerSecond > 0 {
+		middlewares = append(middlewares, NewRateLimiter(cfg.RateLimitPerSecond, cfg.RateLimitBurst, s.trustedProxies).Middleware)
+	}
+	// Production refuses artificial latency even in configs that skipped
+	// validation.
+	if cfg.ArtificialLatency > 0 && cfg.Env != EnvProduction {
+		middlewares = append(middlewares, LatencyMiddleware(cfg.ArtificialLatency))
+	}
+	handlerChain := Chain(middlewares...)(s.router)
+
+	s.cfg.Store(&cfg)
+	s.chain.Store(&handlerChain)
+}
+
+// loadTLSConfig loads the certificate key pair, returning nil when TLS is
+// not configured.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
 }
 
-func NewServer(cfg Config) *http.Server {
+// drainReportInterval is how often the requests still draining are logged
+// during shutdown.
+const drainReportInterval = time.Second
 
-	greeter := NewGreeter()
-	handler := NewHandler(greeter)
-	router := NewRouter(handler)
+// reportDraining logs how many requests are still in flight, now and then
+// every drainReportInterval until drained is closed.
+func (s *Server) reportDraining(drained <-chan struct{}) {
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
 
-	addr := fmt.Sprintf(":%s", cfg.Port)
+	for {
+		s.logger.Info("draining requests", slog.Int64("active_requests", s.activeRequests.Load()))
+		select {
+		case <-drained:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RequestShutdown makes Run shut down gracefully, as if its context were
+// done. It is safe to call more than once.
+func (s *Server) RequestShutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdownRequested) })
+}
+
+// ListenAndRun listens as Listen does and calls Run.
+func (s *Server) ListenAndRun(ctx context.Context) error {
+	ln, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Run(ctx, ln)
+}
 
-	return &http.Server{
-		Addr:    addr,
-		Handler: router,
+// Listen listens on the config's UnixSocket when set, replacing a socket
+// left behind by an earlier run, and on the server's TCP address otherwise.
+// Closing the listener, as shutting down does, removes the socket file. An
+// address another process is listening on is reported in terms of the
+// setting to change; the error still matches syscall.EADDRINUSE.
+func (s *Server) Listen() (net.Listener, error) {
+	if s.unixSocket == "" {
+		ln, err := net.Listen("tcp", s.Addr)
+		if errors.Is(err, syscall.EADDRINUSE) {
+			_, port, _ := net.SplitHostPort(s.Addr)
+			return nil, fmt.Errorf("port %s is already in use: stop the process using it or set PORT to a free port: %w", port, err)
+		}
+		return ln, err
+	}
+	if info, err := os.Stat(s.unixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// Only a socket nothing answers on is stale.
+		if conn, err := net.Dial("unix", s.unixSocket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is already in use: stop the process using it or set UNIX_SOCKET to another path: %w", s.unixSocket, syscall.EADDRINUSE)
+		}
+		if err := os.Remove(s.unixSocket); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", s.unixSocket)
+}
+
+// Warmup gets the server ready for traffic: it renders the templates,
+// greets every location once so caches in front of slow greeters are
+// primed, runs the WithWarmup hooks and then waits out the config's
+// WarmupDelay.
+func (s *Server) Warmup(ctx context.Context) error {
+	if err := s.handler.checkTemplates(); err != nil {
+		return err
+	}
+	for _, location := range s.handler.greeter.Locations() {
+		if _, err := s.handler.greeter.GreetCtx(ctx, location); err != nil && !errors.Is(err, ErrUnknownLocation) {
+			return fmt.Errorf("greeting %s: %w", location, err)
+		}
+	}
+	for _, hook := range s.warmupHooks {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+
+	if s.warmupDelay > 0 {
+		timer := time.NewTimer(s.warmupDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Run serves on ln, over TLS when configured, until ctx is cancelled or
+// RequestShutdown is called, then shuts down gracefully, giving in-flight
+// requests up to the shutdown timeout to complete. The server reports ready
+// only once Warmup has succeeded and while it is serving; a failed warmup
+// shuts the server down.
+func (s *Server) Run(ctx context.Context, ln net.Listener) error {
+	if s.greetingsFile != nil {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		defer stopWatching()
+		go s.greetingsFile.Watch(watchCtx, s.greetingsReloadInterval, s.logger)
+	}
+
+	serveErr := make(chan error, 1)
+	warmupErr := make(chan error, 1)
+	warmupCtx, cancelWarmup := context.WithCancel(ctx)
+	var warming sync.WaitGroup
+	// stopWarmup must return before readiness is withdrawn, or a warmup
+	// finishing late could report ready again.
+	stopWarmup := func() {
+		cancelWarmup()
+		warming.Wait()
+	}
+	defer stopWarmup()
+	warming.Go(func() {
+		if err := s.Warmup(warmupCtx); err != nil {
+			if warmupCtx.Err() == nil {
+				warmupErr <- err
+			}
+			return
+		}
+		if warmupCtx.Err() == nil {
+			s.handler.SetReady(true)
+		}
+	})
+	go func() {
+		if s.TLSConfig != nil {
+			serveErr <- s.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- s.Serve(ln)
+	}()
+
+	var runErr error
+	select {
+	case err := <-serveErr:
+		stopWarmup()
+		s.handler.SetReady(false)
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	case <-s.shutdownRequested:
+	case err := <-warmupErr:
+		s.logger.Error("warmup failed", slog.Any("error", err))
+		runErr = fmt.Errorf("warming up: %w", err)
+	}
+	stopWarmup()
+	s.handler.SetReady(false)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	drained := make(chan struct{})
+	var reporting sync.WaitGroup
+	reporting.Go(func() { s.reportDraining(drained) })
+	err := s.Shutdown(shutdownCtx)
+	close(drained)
+	reporting.Wait()
+	if err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := s.shutdownTracing(shutdownCtx); err != nil {
+		return fmt.Errorf("flushing traces: %w", err)
 	}
+	return runErr
 }
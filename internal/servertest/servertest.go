@@ -0,0 +1,44 @@
+// Package servertest starts the real server on a local HTTP server for
+// integration tests. It lives outside internal so that package need not
+// import testing and net/http/httptest into the binary.
+package servertest
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"propertyProject/internal"
+)
+
+// NewTestServer serves a server built by internal.NewServer from the default
+// config, so requests pass through its full middleware chain, gzip included,
+// with a default GreeterService and handler using the embedded templates and
+// static files, marked ready and logging nowhere. The returned cleanup
+// closes the server; it also runs when t finishes, so calling it is only
+// needed to stop the server early.
+func NewTestServer(t testing.TB) (*httptest.Server, func()) {
+	t.Helper()
+
+	logger := slog.New(slog.DiscardHandler)
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithLogger(logger))
+	if err != nil {
+		t.Fatalf("servertest: creating handler: %v", err)
+	}
+	handler.SetReady(true)
+
+	server, err := internal.NewServer(internal.DefaultConfig(),
+		internal.WithHandler(handler),
+		internal.WithServerLogger(logger),
+	)
+	if err != nil {
+		t.Fatalf("servertest: creating server: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(server.Handler)
+	// Serving with the server's own http.Server keeps its timeouts too.
+	ts.Config = server.Server
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts, ts.Close
+}
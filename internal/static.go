@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticContentTypes are the content types static files are served with,
+// by extension. Anything else is served as application/octet-stream.
+var staticContentTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".html":  "text/html; charset=utf-8",
+	".txt":   "text/plain; charset=utf-8",
+	".json":  "application/json",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".ico":   "image/x-icon",
+	".woff2": "font/woff2",
+}
+
+// explicitContentTypes serves static files with the content type of their
+// extension rather than one sniffed from their contents, and tells browsers
+// not to sniff either, so a file can never be run as something it is not.
+func explicitContentTypes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType, ok := staticContentTypes[strings.ToLower(path.Ext(r.URL.Path))]
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/") || r.URL.Path == "":
+			// Directories are listed as HTML.
+			contentType = staticContentTypes[".html"]
+		case !ok:
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// modTimeFS reports modTime for files whose own modification time is
+// unknown, as it is for everything in an embed.FS, so the file server can
+// send Last-Modified and answer If-Modified-Since.
+type modTimeFS struct {
+	fs.FS
+	modTime time.Time
+}
+
+func (m modTimeFS) Open(name string) (fs.File, error) {
+	f, err := m.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return modTimeFile{File: f, modTime: m.modTime}, nil
+}
+
+type modTimeFile struct {
+	fs.File
+	modTime time.Time
+}
+
+func (f modTimeFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil || !info.ModTime().IsZero() {
+		return info, err
+	}
+	return modTimeInfo{FileInfo: info, modTime: f.modTime}, nil
+}
+
+// Seek and ReadDir pass through, letting the file server serve ranges and
+// list directories.
+func (f modTimeFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("seek not supported")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+func (f modTimeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+	return dir.ReadDir(n)
+}
+
+type modTimeInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (i modTimeInfo) ModTime() time.Time {
+	return i.modTime
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"maps"
+	"sync"
+)
+
+// Stats counts the greetings served per location. It is safe for
+// concurrent use.
+type Stats struct {
+	mu        sync.Mutex
+	greetings map[string]uint64
+}
+
+func NewStats() *Stats {
+	return &Stats{greetings: make(map[string]uint64)}
+}
+
+// RecordGreeting counts one greeting served for location.
+func (s *Stats) RecordGreeting(location string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.greetings[location]++
+}
+
+// Greetings returns a snapshot of the counts by location.
+func (s *Stats) Greetings() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.greetings)
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultGreetings are the greetings built into the service.
+func defaultGreetings() map[string]string {
+	return map[string]string{
+		LocationWorld:    "Hello, World!",
+		LocationUK:       "Hello, UK!",
+		LocationScotland: "Hello, Scotland!",
+		LocationWales:    "Shwmae, Cymru!",
+		LocationFrance:   "Bonjour, France!",
+	}
+}
+
+// MemoryTranslator is a Translator backed by a fixed location→greeting map.
+// It is safe for concurrent use since it never changes.
+type MemoryTranslator struct {
+	greetings map[string]string
+}
+
+// NewMemoryTranslator copies greetings into a new MemoryTranslator.
+func NewMemoryTranslator(greetings map[string]string) *MemoryTranslator {
+	return &MemoryTranslator{greetings: maps.Clone(greetings)}
+}
+
+func (t *MemoryTranslator) Translate(location string) (string, bool) {
+	greeting, ok := t.greetings[location]
+	return greeting, ok
+}
+
+// Locations returns the translated locations in sorted order.
+func (t *MemoryTranslator) Locations() []string {
+	return slices.Sorted(maps.Keys(t.greetings))
+}
+
+// LoadTranslator reads a JSON object mapping location to greeting from the
+// file at path.
+func LoadTranslator(path string) (*MemoryTranslator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading greetings file: %w", err)
+	}
+	var greetings map[string]string
+	if err := json.Unmarshal(data, &greetings); err != nil {
+		return nil, fmt.Errorf("parsing greetings file %s: %w", path, err)
+	}
+	return &MemoryTranslator{greetings: greetings}, nil
+}
+
+// FileTranslator translates from a greetings file, which Reload and Watch
+// re-read without interrupting translations in flight.
+type FileTranslator struct {
+	path    string
+	current atomic.Pointer[MemoryTranslator]
+
+	// mu guards modTime and size, which identify the version of the file
+	// last read.
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewFileTranslator loads the greetings file at path.
+func NewFileTranslator(path string) (*FileTranslator, error) {
+	t := &FileTranslator{path: path}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *FileTranslator) Translate(location string) (string, bool) {
+	return t.current.Load().Translate(location)
+}
+
+// Locations returns the translated locations in sorted order.
+func (t *FileTranslator) Locations() []string {
+	return t.current.Load().Locations()
+}
+
+// Reload re-reads the greetings file, keeping the greetings it had when the
+// file cannot be read or parsed.
+func (t *FileTranslator) Reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.reload(true)
+	return err
+}
+
+// reload re-reads the file if force is set or it has changed since it was
+// last read, reporting whether it did. t.mu must be held.
+func (t *FileTranslator) reload(force bool) (bool, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false, fmt.Errorf("reading greetings file: %w", err)
+	}
+	if !force && info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return false, nil
+	}
+	// Remember this version even if it fails to load, so a broken file is
+	// reported once rather than on every poll.
+	t.modTime, t.size = info.ModTime(), info.Size()
+
+	loaded, err := LoadTranslator(t.path)
+	if err != nil {
+		return false, err
+	}
+	t.current.Store(loaded)
+	return true, nil
+}
+
+// Watch polls the greetings file every interval until ctx is done,
+// reloading it when it changes. Failed reloads are logged and the previous
+// greetings kept.
+func (t *FileTranslator) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		reloaded, err := t.reload(false)
+		t.mu.Unlock()
+		if err != nil {
+			logger.ErrorContext(ctx, "greetings reload failed", slog.String("path", t.path), slog.Any("error", err))
+		} else if reloaded {
+			logger.InfoContext(ctx, "greetings reloaded", slog.String("path", t.path))
+		}
+	}
+}
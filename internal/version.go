@@ -0,0 +1,22 @@
+package internal
+
+// Build details, set at link time with
+//
+//	go build -ldflags "-X propertyProject/internal.Version=v1.2.3 -X propertyProject/internal.Commit=$(git rev-parse HEAD) -X propertyProject/internal.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// BuildInfo identifies the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// CurrentBuild returns the build details set at link time.
+func CurrentBuild() BuildInfo {
+	return BuildInfo{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}
@@ -0,0 +1,119 @@
+package specifications
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"propertyProject/internal"
+	"propertyProject/internal/greetertest"
+)
+
+func TestCachingGreeter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	backend := greetertest.NewFakeGreeter(map[string]string{internal.LocationUK: "Hello, UK!"})
+	greeter := internal.NewCachingGreeter(backend, time.Minute, internal.WithCacheClock(clock))
+
+	greet := func() {
+		t.Helper()
+		result, err := greeter.GreetCtx(context.Background(), internal.LocationUK)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != "Hello, UK!" {
+			t.Errorf("expected %q, got %q", "Hello, UK!", result)
+		}
+	}
+
+	greet()
+	now = now.Add(59 * time.Second)
+	greet()
+	if calls := backend.Calls(); len(calls) != 1 {
+		t.Fatalf("expected one backend call within the TTL, got %v", calls)
+	}
+
+	now = now.Add(time.Second)
+	greet()
+	if calls := backend.Calls(); len(calls) != 2 {
+		t.Errorf("expected a second backend call after expiry, got %v", calls)
+	}
+}
+
+func TestCachingGreeter_DoesNotCacheErrors(t *testing.T) {
+	backend := greetertest.NewFakeGreeter(nil)
+	greeter := internal.NewCachingGreeter(backend, time.Minute)
+
+	for range 2 {
+		if _, err := greeter.GreetE("atlantis"); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Fatalf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	}
+	if calls := backend.Calls(); !slices.Equal(calls, []string{"atlantis", "atlantis"}) {
+		t.Errorf("expected every failing greeting to reach the backend, got %v", calls)
+	}
+}
+
+func TestCachingGreeter_ConcurrentUse(t *testing.T) {
+	greeter := internal.NewCachingGreeter(internal.NewGreeter(), time.Minute)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := greeter.GreetE(internal.LocationFrance); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestCachingGreeter_CachesResolvedLocations(t *testing.T) {
+	greeter := internal.NewCachingGreeter(internal.NewGreeter(), time.Minute)
+
+	for _, location := range []string{"uk", "gb", "uk-random", "uk-anything-else"} {
+		if _, err := greeter.GreetE(location); err != nil {
+			t.Fatalf("unexpected error greeting %q: %v", location, err)
+		}
+	}
+	if _, err := greeter.GreetE("atlantis"); !errors.Is(err, internal.ErrUnknownLocation) {
+		t.Fatalf("expected %v, got %v", internal.ErrUnknownLocation, err)
+	}
+
+	if got := greeter.Len(); got != 1 {
+		t.Errorf("expected one entry for uk and its aliases, got %d", got)
+	}
+}
+
+func TestCachingGreeter_SweepsExpiredEntries(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	backend := greetertest.NewFakeGreeter(map[string]string{
+		internal.LocationUK:     "Hello, UK!",
+		internal.LocationFrance: "Bonjour, France!",
+		internal.LocationWorld:  "Hello, World!",
+	})
+	greeter := internal.NewCachingGreeter(backend, time.Minute, internal.WithCacheClock(clock))
+
+	for _, location := range []string{internal.LocationUK, internal.LocationFrance} {
+		if _, err := greeter.GreetE(location); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := greeter.Len(); got != 2 {
+		t.Fatalf("expected 2 entries, got %d", got)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := greeter.GreetE(internal.LocationWorld); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := greeter.Len(); got != 1 {
+		t.Errorf("expected the expired entries to be freed, leaving 1, got %d", got)
+	}
+}
@@ -0,0 +1,130 @@
+package specifications
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"propertyProject/internal"
+)
+
+// flakyGreeter fails with err while it is set, counting every call
+type flakyGreeter struct {
+	unknownGreeter
+	err   error
+	calls int
+}
+
+func (g *flakyGreeter) GreetE(location string) (string, error) {
+	return g.GreetCtx(context.Background(), location)
+}
+
+func (g *flakyGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	g.calls++
+	if g.err != nil {
+		return "", g.err
+	}
+	return "Hello, UK!", nil
+}
+
+func TestCircuitBreakerGreeter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	backend := &flakyGreeter{err: errors.New("backend down")}
+	greeter := internal.NewCircuitBreakerGreeter(backend, 3, time.Minute,
+		internal.WithCircuitBreakerClock(func() time.Time { return now }),
+	)
+
+	for i := range 3 {
+		if _, err := greeter.GreetE(internal.LocationUK); !errors.Is(err, backend.err) {
+			t.Fatalf("failure %d: expected the backend error, got %v", i+1, err)
+		}
+	}
+
+	_, err := greeter.GreetE(internal.LocationUK)
+	var open *internal.CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, internal.ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+	if open.RetryAfter != time.Minute {
+		t.Errorf("expected to retry after %s, got %s", time.Minute, open.RetryAfter)
+	}
+	if backend.calls != 3 {
+		t.Errorf("expected an open circuit to fail fast, got %d backend calls", backend.calls)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := greeter.GreetE(internal.LocationUK); !errors.Is(err, backend.err) {
+		t.Fatalf("expected a trial call after the cooldown, got %v", err)
+	}
+	if _, err := greeter.GreetE(internal.LocationUK); !errors.Is(err, internal.ErrCircuitOpen) {
+		t.Fatalf("expected a failed trial to reopen the circuit, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	backend.err = nil
+	if result, err := greeter.GreetE(internal.LocationUK); err != nil || result != "Hello, UK!" {
+		t.Fatalf("expected recovery after the cooldown, got %q (%v)", result, err)
+	}
+	backend.err = errors.New("backend down again")
+	if _, err := greeter.GreetE(internal.LocationUK); !errors.Is(err, backend.err) {
+		t.Errorf("expected a success to close the circuit, got %v", err)
+	}
+}
+
+func TestCircuitBreakerGreeter_IgnoresUnknownLocations(t *testing.T) {
+	greeter := internal.NewCircuitBreakerGreeter(unknownGreeter{}, 1, time.Minute)
+
+	for range 3 {
+		if _, err := greeter.GreetE("atlantis"); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Fatalf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	}
+}
+
+func TestHandler_CircuitOpen(t *testing.T) {
+	greeter := internal.NewCircuitBreakerGreeter(&flakyGreeter{err: errors.New("backend down")}, 1, 90*time.Second)
+	greeter.GreetE(internal.LocationUK)
+	router := internal.NewRouter(newHandler(t, greeter), internal.NewMetrics())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/greetings/uk", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("expected Retry-After %q, got %q", "90", got)
+	}
+}
+
+func TestCircuitBreakerGreeter_IgnoresCallerDeadlines(t *testing.T) {
+	gated := gatedGreeter{Greeter: internal.NewGreeter(), gated: internal.LocationUK, release: make(chan struct{})}
+	greeter := internal.NewCircuitBreakerGreeter(gated, 2, time.Minute)
+	server, err := internal.NewServer(internal.Config{Port: "0"},
+		internal.WithServerLogger(discardLogger),
+		internal.WithHandler(newHandler(t, greeter)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/hello/uk", nil)
+		req.Header.Set(internal.RequestDeadlineHeader, "0.001")
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("expected status %d, got %d", http.StatusGatewayTimeout, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello/world", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the circuit to stay closed with status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package specifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"propertyProject/internal"
+)
+
+func TestErrorResponse_Shape(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	limited := internal.NewRateLimiter(1, 1, nil).Middleware(router)
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		path     string
+		requests int
+		status   int
+		expected internal.ErrorDetail
+	}{
+		{
+			name:     "UnknownLocation",
+			handler:  router,
+			path:     "/hello/atlantis",
+			requests: 1,
+			status:   http.StatusNotFound,
+			expected: internal.ErrorDetail{Code: internal.ErrorCodeUnknownLocation, Message: "unknown location"},
+		},
+		{
+			name:     "RateLimited",
+			handler:  limited,
+			path:     "/hello-uk",
+			requests: 2,
+			status:   http.StatusTooManyRequests,
+			expected: internal.ErrorDetail{Code: internal.ErrorCodeRateLimited, Message: "Too Many Requests"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec *httptest.ResponseRecorder
+			for range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				req.Header.Set("Accept", "application/json")
+				rec = httptest.NewRecorder()
+				tt.handler.ServeHTTP(rec, req)
+			}
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected Content-Type %q, got %q", "application/json", got)
+			}
+			var body internal.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode JSON: %v", err)
+			}
+			if body.Error != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, body.Error)
+			}
+		})
+	}
+}
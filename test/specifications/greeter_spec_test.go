@@ -1,7 +1,19 @@
 package specifications
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message/catalog"
 
 	"propertyProject/internal"
 )
@@ -28,6 +40,14 @@ func GreeterSpec(t *testing.T, greeter GreeterContract) {
 			t.Errorf("expected %q, got %q", expected, result)
 		}
 	})
+
+	t.Run("ReturnsHelloFrance", func(t *testing.T) {
+		result := greeter.Greet(internal.LocationFrance)
+		expected := "Bonjour, France!"
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
 }
 
 // TestGreeter_Domain runs specs against the pure domain implementation
@@ -35,3 +55,606 @@ func TestGreeter_Domain(t *testing.T) {
 	greeter := internal.NewGreeter()
 	GreeterSpec(t, greeter)
 }
+
+// TestGreeter_UnknownLocation checks GreetE reports locations it does not know
+func TestGreeter_UnknownLocation(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	_, err := greeter.GreetE("atlantis")
+	if !errors.Is(err, internal.ErrUnknownLocation) {
+		t.Errorf("expected %v, got %v", internal.ErrUnknownLocation, err)
+	}
+
+	if result := greeter.Greet("atlantis"); result != "Hello, World!" {
+		t.Errorf("expected Greet to fall back to %q, got %q", "Hello, World!", result)
+	}
+}
+
+func TestGreeter_Register(t *testing.T) {
+	t.Run("GreetsRegisteredLocation", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.Register("spain", "Hola, España!")
+
+		result := greeter.Greet("spain")
+		expected := "Hola, España!"
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("OverwritesExistingLocation", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.Register(internal.LocationUK, "Alright, UK!")
+
+		result := greeter.Greet(internal.LocationUK)
+		expected := "Alright, UK!"
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("NoFallbackWhenDisabled", func(t *testing.T) {
+		greeter := internal.NewGreeter(internal.WithFallback(""))
+
+		if result := greeter.Greet("atlantis"); result != "" {
+			t.Errorf("expected no greeting, got %q", result)
+		}
+	})
+}
+
+func TestGreeter_TimeOfDay(t *testing.T) {
+	tests := []struct {
+		hour     int
+		expected string
+	}{
+		{hour: 0, expected: "Good evening, UK!"},
+		{hour: internal.MorningStartHour - 1, expected: "Good evening, UK!"},
+		{hour: internal.MorningStartHour, expected: "Good morning, UK!"},
+		{hour: internal.AfternoonStartHour - 1, expected: "Good morning, UK!"},
+		{hour: internal.AfternoonStartHour, expected: "Good afternoon, UK!"},
+		{hour: internal.EveningStartHour - 1, expected: "Good afternoon, UK!"},
+		{hour: internal.EveningStartHour, expected: "Good evening, UK!"},
+		{hour: 23, expected: "Good evening, UK!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected+" at "+strconv.Itoa(tt.hour), func(t *testing.T) {
+			now := time.Date(2026, time.January, 1, tt.hour, 30, 0, 0, time.UTC)
+			greeter := internal.NewGreeter(internal.WithClock(func() time.Time { return now }))
+
+			if result := greeter.GreetNow(internal.LocationUK); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+			if result := greeter.GreetAtTime(internal.LocationUK, now); result != tt.expected {
+				t.Errorf("expected GreetAtTime %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGreeter_GreetCtx(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	t.Run("GreetsWithLiveContext", func(t *testing.T) {
+		result, err := greeter.GreetCtx(context.Background(), internal.LocationUK)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != "Hello, UK!" {
+			t.Errorf("expected %q, got %q", "Hello, UK!", result)
+		}
+	})
+
+	t.Run("ReturnsCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := greeter.GreetCtx(ctx, internal.LocationUK)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+// fakeTranslator records the locations it is asked to translate.
+type fakeTranslator struct {
+	greetings map[string]string
+	calls     []string
+}
+
+func (f *fakeTranslator) Translate(location string) (string, bool) {
+	f.calls = append(f.calls, location)
+	greeting, ok := f.greetings[location]
+	return greeting, ok
+}
+
+func TestGreeter_Translator(t *testing.T) {
+	t.Run("DelegatesToTranslator", func(t *testing.T) {
+		translator := &fakeTranslator{greetings: map[string]string{"spain": "Hola, España!"}}
+		greeter := internal.NewGreeter(internal.WithTranslator(translator))
+
+		result, err := greeter.GreetE("spain")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != "Hola, España!" {
+			t.Errorf("expected %q, got %q", "Hola, España!", result)
+		}
+		if len(translator.calls) != 1 || translator.calls[0] != "spain" {
+			t.Errorf("expected one Translate call for spain, got %v", translator.calls)
+		}
+	})
+
+	t.Run("ReturnsErrUnknownLocationWhenNotTranslated", func(t *testing.T) {
+		translator := &fakeTranslator{}
+		greeter := internal.NewGreeter(internal.WithTranslator(translator))
+
+		_, err := greeter.GreetE(internal.LocationUK)
+		if !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	})
+
+	t.Run("RegisteredGreetingOverridesTranslator", func(t *testing.T) {
+		translator := &fakeTranslator{greetings: map[string]string{"spain": "Hola, España!"}}
+		greeter := internal.NewGreeter(internal.WithTranslator(translator))
+		greeter.Register("spain", "¡Buenos días, España!")
+
+		if result := greeter.Greet("spain"); result != "¡Buenos días, España!" {
+			t.Errorf("expected %q, got %q", "¡Buenos días, España!", result)
+		}
+		if len(translator.calls) != 0 {
+			t.Errorf("expected no Translate calls, got %v", translator.calls)
+		}
+	})
+}
+
+func TestLoadTranslator(t *testing.T) {
+	t.Run("GreetsFromFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "greetings.json")
+		content := `{"world": "Hiya, World!", "spain": "Hola, España!"}`
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write greetings file: %v", err)
+		}
+
+		translator, err := internal.LoadTranslator(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		greeter := internal.NewGreeter(internal.WithTranslator(translator))
+
+		for location, expected := range map[string]string{
+			internal.LocationWorld: "Hiya, World!",
+			"spain":                "Hola, España!",
+		} {
+			if result := greeter.Greet(location); result != expected {
+				t.Errorf("expected %q for %s, got %q", expected, location, result)
+			}
+		}
+		if _, err := greeter.GreetE(internal.LocationUK); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected %v for a location missing from the file, got %v", internal.ErrUnknownLocation, err)
+		}
+	})
+
+	t.Run("RejectsInvalidJSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "greetings.json")
+		if err := os.WriteFile(path, []byte(`{"world": `), 0o600); err != nil {
+			t.Fatalf("failed to write greetings file: %v", err)
+		}
+
+		if _, err := internal.LoadTranslator(path); err == nil {
+			t.Fatal("expected an error for invalid JSON")
+		}
+		if _, err := internal.NewServer(internal.Config{Port: "0", GreetingsFile: path}, internal.WithServerLogger(discardLogger)); err == nil {
+			t.Fatal("expected NewServer to fail for invalid JSON")
+		}
+	})
+}
+
+func TestGreeter_Variants(t *testing.T) {
+	variants := []string{"Hello, World!", "Hi, World!", "Hey, World!"}
+
+	t.Run("PickerChoosesDeterministically", func(t *testing.T) {
+		var offered [][]string
+		greeter := internal.NewGreeter(internal.WithPicker(func(v []string) string {
+			offered = append(offered, v)
+			return v[len(offered)%len(v)]
+		}))
+		greeter.RegisterVariants(internal.LocationWorld, variants...)
+
+		for i, expected := range []string{"Hi, World!", "Hey, World!", "Hello, World!"} {
+			if result := greeter.Greet(internal.LocationWorld); result != expected {
+				t.Errorf("greeting %d: expected %q, got %q", i, expected, result)
+			}
+		}
+		for _, v := range offered {
+			if !slices.Equal(v, variants) {
+				t.Errorf("expected the picker to be offered %v, got %v", variants, v)
+			}
+		}
+	})
+
+	t.Run("DefaultPickerStaysWithinVariants", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.RegisterVariants(internal.LocationWorld, variants...)
+
+		for range 100 {
+			if result := greeter.Greet(internal.LocationWorld); !slices.Contains(variants, result) {
+				t.Fatalf("expected one of %v, got %q", variants, result)
+			}
+		}
+	})
+
+	t.Run("SingleVariantSkipsPicker", func(t *testing.T) {
+		greeter := internal.NewGreeter(internal.WithPicker(func([]string) string {
+			t.Fatal("expected the picker not to be called")
+			return ""
+		}))
+		greeter.Register(internal.LocationWorld, "Hello, World!")
+
+		if result := greeter.Greet(internal.LocationWorld); result != "Hello, World!" {
+			t.Errorf("expected %q, got %q", "Hello, World!", result)
+		}
+	})
+}
+
+func TestGreeter_Aliases(t *testing.T) {
+	t.Run("ResolvesBuiltInAliases", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+
+		for alias, expected := range map[string]string{"gb": "Hello, UK!", "earth": "Hello, World!"} {
+			if result := greeter.Greet(alias); result != expected {
+				t.Errorf("expected %q for %s, got %q", expected, alias, result)
+			}
+		}
+	})
+
+	t.Run("ResolvesRegisteredAlias", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.RegisterAlias("fr", internal.LocationFrance)
+
+		result, err := greeter.GreetE("fr")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != "Bonjour, France!" {
+			t.Errorf("expected %q, got %q", "Bonjour, France!", result)
+		}
+	})
+
+	t.Run("UnknownCanonical", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.RegisterAlias("atlantis", "lost-city")
+
+		if _, err := greeter.GreetE("atlantis"); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	})
+
+	t.Run("ReRegisteringOverrides", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.RegisterAlias("gb", internal.LocationFrance)
+
+		if result := greeter.Greet("gb"); result != "Bonjour, France!" {
+			t.Errorf("expected %q, got %q", "Bonjour, France!", result)
+		}
+	})
+}
+
+func TestGreeter_GreetCount(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{n: -2, expected: "Hello, UK!"},
+		{n: 0, expected: "Hello, UK!"},
+		{n: 1, expected: "Hello, UK!"},
+		{n: 2, expected: "Hello, UK! (x2)"},
+		{n: 10, expected: "Hello, UK! (x10)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.n), func(t *testing.T) {
+			if result := greeter.GreetCount(internal.LocationUK, tt.n); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGreeter_GreetLang(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	tests := []struct {
+		name     string
+		location string
+		lang     string
+		expected string
+	}{
+		{name: "Spanish", location: internal.LocationWorld, lang: "es", expected: "Hola, World!"},
+		{name: "French", location: internal.LocationUK, lang: "fr", expected: "Bonjour, UK!"},
+		{name: "RegionalTag", location: internal.LocationWorld, lang: "es-MX", expected: "Hola, World!"},
+		{name: "UnknownFallsBackToEnglish", location: internal.LocationFrance, lang: "xx", expected: "Hello, France!"},
+		{name: "EmptyKeepsGreeting", location: internal.LocationFrance, lang: "", expected: "Bonjour, France!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := greeter.GreetLang(tt.location, tt.lang); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGreeter_DefaultLocation(t *testing.T) {
+	t.Run("FallsBackToConfiguredDefault", func(t *testing.T) {
+		greeter := internal.NewGreeter(internal.WithFallback(internal.LocationFrance))
+
+		if result := greeter.Greet("atlantis"); result != "Bonjour, France!" {
+			t.Errorf("expected %q, got %q", "Bonjour, France!", result)
+		}
+	})
+
+	t.Run("ServerAcceptsKnownDefault", func(t *testing.T) {
+		if _, err := internal.NewServer(internal.Config{Port: "0", DefaultLocation: internal.LocationUK}, internal.WithServerLogger(discardLogger)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ServerRejectsUnknownDefault", func(t *testing.T) {
+		_, err := internal.NewServer(internal.Config{Port: "0", DefaultLocation: "atlantis"}, internal.WithServerLogger(discardLogger))
+		if !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	})
+}
+
+func TestGreeter_SubLocations(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	tests := []struct {
+		location string
+		expected string
+	}{
+		{location: internal.LocationScotland, expected: "Hello, Scotland!"},
+		{location: internal.LocationWales, expected: "Shwmae, Cymru!"},
+		{location: "uk-xyz", expected: "Hello, UK!"},
+		{location: "uk-wales-gwynedd", expected: "Shwmae, Cymru!"},
+		{location: "xyz", expected: "Hello, World!"},
+		{location: "xyz-uk", expected: "Hello, World!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			if result := greeter.Greet(tt.location); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("UnknownParentIsUnknown", func(t *testing.T) {
+		if _, err := greeter.GreetE("xyz-abc"); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected %v, got %v", internal.ErrUnknownLocation, err)
+		}
+	})
+}
+
+func TestFileTranslator_Reloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greetings.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write greetings file: %v", err)
+		}
+	}
+	write(`{"world": "Hello, World!"}`)
+
+	translator, err := internal.NewFileTranslator(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	greeter := internal.NewGreeter(internal.WithTranslator(translator))
+
+	t.Run("WatchPicksUpChanges", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go translator.Watch(ctx, 10*time.Millisecond, discardLogger)
+
+		write(`{"world": "Howdy, World!", "spain": "Hola, España!"}`)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for greeter.Greet(internal.LocationWorld) != "Howdy, World!" {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the reloaded greeting, still got %q", greeter.Greet(internal.LocationWorld))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if result := greeter.Greet("spain"); result != "Hola, España!" {
+			t.Errorf("expected %q, got %q", "Hola, España!", result)
+		}
+	})
+
+	t.Run("KeepsGreetingsOnParseError", func(t *testing.T) {
+		write(`{"world": `)
+
+		if err := translator.Reload(); err == nil {
+			t.Fatal("expected an error for invalid JSON")
+		}
+		if result := greeter.Greet(internal.LocationWorld); result != "Howdy, World!" {
+			t.Errorf("expected the previous greeting %q, got %q", "Howdy, World!", result)
+		}
+	})
+}
+
+// TestGreeter_ConcurrentRegistration is most useful under go test -race.
+func TestGreeter_ConcurrentRegistration(t *testing.T) {
+	greeter := internal.NewGreeter()
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		location := "place-" + strconv.Itoa(i)
+		wg.Go(func() {
+			for range 100 {
+				greeter.Register(location, "Hello, "+location+"!")
+				greeter.RegisterVariants(location, "Hi!", "Hey!")
+				greeter.RegisterAlias("alias-"+location, location)
+				greeter.SetEnabled(location, true)
+			}
+		})
+		wg.Go(func() {
+			for range 100 {
+				greeter.Greet(location)
+				greeter.GreetE("alias-" + location)
+				greeter.Locations()
+			}
+		})
+	}
+	wg.Wait()
+
+	for i := range 10 {
+		location := "place-" + strconv.Itoa(i)
+		if result, err := greeter.GreetE("alias-" + location); err != nil || (result != "Hi!" && result != "Hey!") {
+			t.Errorf("expected a registered variant for %s, got %q (%v)", location, result, err)
+		}
+	}
+}
+
+func TestGreeter_Decorations(t *testing.T) {
+	decorations := map[string]string{internal.LocationUK: "🇬🇧"}
+
+	tests := []struct {
+		name     string
+		greeter  *internal.GreeterService
+		greet    func(g *internal.GreeterService) string
+		expected string
+	}{
+		{name: "UndecoratedByDefault", greeter: internal.NewGreeter(), greet: func(g *internal.GreeterService) string { return g.Greet(internal.LocationUK) }, expected: "Hello, UK!"},
+		{name: "Decorated", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.Greet(internal.LocationUK) }, expected: "Hello, UK! 🇬🇧"},
+		{name: "DecoratedSubLocation", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.Greet("uk-cornwall") }, expected: "Hello, UK! 🇬🇧"},
+		{name: "NoDecorationForLocation", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.Greet(internal.LocationWorld) }, expected: "Hello, World!"},
+		{name: "DecoratedCount", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetCount(internal.LocationUK, 2) }, expected: "Hello, UK! 🇬🇧 (x2)"},
+		{name: "DecoratedName", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetName(internal.LocationUK, "Alice") }, expected: "Hello, Alice! 🇬🇧"},
+		{name: "DecoratedNameSubLocation", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetName("uk-cornwall", "Alice") }, expected: "Hello, Alice! 🇬🇧"},
+		{name: "DecoratedLang", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetLang(internal.LocationUK, "es") }, expected: "Hola, UK! 🇬🇧"},
+		{name: "NameWithoutDecoration", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetName(internal.LocationWorld, "Alice") }, expected: "Hello, Alice!"},
+		{name: "LangWithoutDecoration", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string { return g.GreetLang(internal.LocationWorld, "es") }, expected: "Hola, World!"},
+		{name: "PersonalizedKeepsDecoration", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string {
+			return g.Personalize(internal.LocationUK, "Hello, UK! 🇬🇧", internal.GreetOptions{Name: "Alice"})
+		}, expected: "Hello, Alice! 🇬🇧"},
+		{name: "TimeOfDayUndecorated", greeter: internal.NewGreeter(internal.WithDecorations(decorations)), greet: func(g *internal.GreeterService) string {
+			return g.GreetAtTime(internal.LocationUK, time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC))
+		}, expected: "Good morning, UK!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.greet(tt.greeter); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGreeter_LocationFor(t *testing.T) {
+	greeter := internal.NewGreeter(internal.WithDecorations(map[string]string{internal.LocationFrance: "🇫🇷"}))
+	greeter.Register("narnia", "Hello, Narnia!")
+	greeter.Register("atlantis", "Ahoy!")
+	greeter.Register("lilliput", "Ahoy!")
+	greeter.RegisterVariants("mars", "Greetings, Earthling!", "Nanu nanu!")
+	// Re-registering keeps atlantis's place ahead of lilliput.
+	greeter.Register("atlantis", "Ahoy!")
+	greeter.Register("uk", "Hello, Narnia!")
+	greeter.Register("ghost-town", "Boo!")
+	greeter.SetEnabled("ghost-town", false)
+
+	tests := []struct {
+		name     string
+		message  string
+		location string
+		found    bool
+	}{
+		{name: "Registered", message: "Hello, Narnia!", location: "narnia", found: true},
+		{name: "Translated", message: "Hello, World!", location: internal.LocationWorld, found: true},
+		{name: "Variant", message: "Nanu nanu!", location: "mars", found: true},
+		{name: "Decorated", message: "Bonjour, France! 🇫🇷", location: internal.LocationFrance, found: true},
+		{name: "DuplicateFirstRegisteredWins", message: "Ahoy!", location: "atlantis", found: true},
+		{name: "OverriddenTranslation", message: "Hello, UK!", found: false},
+		{name: "Disabled", message: "Boo!", found: false},
+		{name: "Miss", message: "Howdy!", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, found := greeter.LocationFor(tt.message)
+			if location != tt.location || found != tt.found {
+				t.Errorf("expected (%q, %t), got (%q, %t)", tt.location, tt.found, location, found)
+			}
+		})
+	}
+
+	t.Run("RemovedGivesWayToNext", func(t *testing.T) {
+		greeter.RegisterVariants("atlantis")
+		if location, _ := greeter.LocationFor("Ahoy!"); location != "lilliput" {
+			t.Errorf("expected %q, got %q", "lilliput", location)
+		}
+	})
+}
+
+func TestGreeter_Catalog(t *testing.T) {
+	builder := catalog.NewBuilder()
+	builder.SetString(language.English, internal.SalutationKey, "Hi")
+	builder.SetString(language.French, internal.SalutationKey, "Salut")
+	builder.SetString(language.CanadianFrench, internal.SalutationKey, "Allô")
+	greeter := internal.NewGreeter(internal.WithCatalog(builder))
+
+	tests := []struct {
+		name     string
+		lang     string
+		expected string
+	}{
+		{name: "English", lang: "en", expected: "Hi, World!"},
+		{name: "French", lang: "fr", expected: "Salut, World!"},
+		{name: "RegionalFallsBackToBase", lang: "fr-BE", expected: "Salut, World!"},
+		{name: "RegionalEntry", lang: "fr-CA", expected: "Allô, World!"},
+		{name: "CaseInsensitive", lang: "FR", expected: "Salut, World!"},
+		{name: "MissingFallsBackToEnglish", lang: "es", expected: "Hi, World!"},
+		{name: "MalformedFallsBackToEnglish", lang: "not a tag!", expected: "Hi, World!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := greeter.GreetLang(internal.LocationWorld, tt.lang); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGreeter_CatalogCount(t *testing.T) {
+	builder := catalog.NewBuilder()
+	builder.Set(language.English, internal.CountKey, plural.Selectf(2, "%d",
+		"one", "%[1]s (just you)",
+		"other", "%[1]s (all %[2]d of you)",
+	))
+	greeter := internal.NewGreeter(internal.WithCatalog(builder))
+
+	tests := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{name: "Singular", n: 1, expected: "Hello, UK! (just you)"},
+		{name: "Plural", n: 3, expected: "Hello, UK! (all 3 of you)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := greeter.GreetCount(internal.LocationUK, tt.n); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,1887 @@
+package specifications
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"propertyProject"
+	"propertyProject/internal"
+	"propertyProject/internal/greetertest"
+)
+
+// unknownGreeter knows no locations at all
+type unknownGreeter struct{}
+
+func (unknownGreeter) Greet(location string) string { return "" }
+
+func (unknownGreeter) GreetE(location string) (string, error) {
+	return "", internal.ErrUnknownLocation
+}
+
+func (unknownGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	return "", internal.ErrUnknownLocation
+}
+
+func (unknownGreeter) GreetName(location, name string) string { return "" }
+
+func (unknownGreeter) GreetCount(location string, n int) string { return "" }
+
+func (unknownGreeter) GreetLang(location, lang string) string { return "" }
+
+func (unknownGreeter) Personalize(location, greeting string, opts internal.GreetOptions) string {
+	return greeting
+}
+
+func (unknownGreeter) Locations() []string { return nil }
+
+// failingGreeter fails every greeting with err
+type failingGreeter struct {
+	unknownGreeter
+	err error
+}
+
+func (g failingGreeter) GreetE(location string) (string, error) { return "", g.err }
+
+func (g failingGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	return "", g.err
+}
+
+// newHandler builds a Handler from the embedded templates
+func newHandler(t *testing.T, greeter internal.Greeter) *internal.Handler {
+	t.Helper()
+	handler, err := internal.NewHandler(greeter)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	return handler
+}
+
+func TestHandler_UnknownLocationReturns404(t *testing.T) {
+	handler := newHandler(t, unknownGreeter{})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+	rec := httptest.NewRecorder()
+	handler.HelloUKHandler(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestHandler_HelloNegotiatesAcceptLanguage(t *testing.T) {
+	handler := newHandler(t, internal.NewGreeter())
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+	}{
+		{name: "French browser", acceptLanguage: "fr-FR,fr;q=0.9", expected: "Bonjour, France!"},
+		{name: "British English", acceptLanguage: "en-GB,en;q=0.8", expected: "Hello, UK!"},
+		{name: "Generic English", acceptLanguage: "en-US,en;q=0.5", expected: "Hello, World!"},
+		{name: "Quality ordering", acceptLanguage: "de;q=0.9,en-GB;q=0.4,fr;q=0.7", expected: "Bonjour, France!"},
+		{name: "Zero quality is excluded", acceptLanguage: "fr;q=0,en-GB;q=0.1", expected: "Hello, UK!"},
+		{name: "Unsupported language", acceptLanguage: "de-DE,ja;q=0.8", expected: "Hello, World!"},
+		{name: "No header", acceptLanguage: "", expected: "Hello, World!"},
+		{name: "Malformed header", acceptLanguage: ";;,q=abc", expected: "Hello, World!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rec := httptest.NewRecorder()
+			handler.HelloHandler(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if result := extractGreeting(rec.Body.String()); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHandler_GreetingContentNegotiation(t *testing.T) {
+	handler := newHandler(t, internal.NewGreeter())
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "JSON", accept: "application/json", contentType: "application/json"},
+		{name: "JSON preferred by quality", accept: "text/html;q=0.5, application/json", contentType: "application/json"},
+		{name: "HTML by default", accept: "", contentType: "text/html; charset=utf-8"},
+		{name: "HTML for browsers", accept: "text/html,application/xhtml+xml,*/*;q=0.8", contentType: "text/html; charset=utf-8"},
+		{name: "HTML for malformed header", accept: "application/json;;q==", contentType: "text/html; charset=utf-8"},
+		{name: "Plain text", accept: "text/plain", contentType: "text/plain; charset=utf-8"},
+		{name: "HTML preferred over plain text", accept: "text/html, text/plain;q=0.9", contentType: "text/html; charset=utf-8"},
+		{name: "HTML for curl", accept: "*/*", contentType: "text/html; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.HelloUKHandler(rec, req)
+
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+
+			var message string
+			switch tt.contentType {
+			case "application/json":
+				var body map[string]string
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatalf("failed to decode JSON: %v", err)
+				}
+				message = body["message"]
+			case "text/plain; charset=utf-8":
+				body := rec.Body.String()
+				if !strings.HasSuffix(body, "\n") {
+					t.Errorf("expected a trailing newline, got %q", body)
+				}
+				message = strings.TrimSuffix(body, "\n")
+			default:
+				message = extractGreeting(rec.Body.String())
+			}
+			if message != "Hello, UK!" {
+				t.Errorf("expected %q, got %q", "Hello, UK!", message)
+			}
+		})
+	}
+}
+
+func TestNewHandler_ErrorsWhenTemplatesMissing(t *testing.T) {
+	_, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(fstest.MapFS{}))
+	if err == nil {
+		t.Fatal("expected an error when templates are missing")
+	}
+}
+
+// BenchmarkRenderGreeting_ParsePerRequest measures the old approach of
+// parsing the greeting template on every request
+func BenchmarkRenderGreeting_ParsePerRequest(b *testing.B) {
+	for b.Loop() {
+		tmpl, err := template.ParseFS(propertyproject.Assets, "templates/partials/greeting.html")
+		if err != nil {
+			b.Fatal(err)
+		}
+		tmpl.Execute(io.Discard, map[string]string{"Message": "Hello, UK!"})
+	}
+}
+
+// BenchmarkRenderGreeting_Cached measures rendering with the templates
+// parsed once in NewHandler
+func BenchmarkRenderGreeting_Cached(b *testing.B) {
+	handler, err := internal.NewHandler(internal.NewGreeter())
+	if err != nil {
+		b.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+
+	for b.Loop() {
+		handler.HelloUKHandler(httptest.NewRecorder(), req)
+	}
+}
+
+func TestRouter_ServesEmbeddedStaticFiles(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	req := httptest.NewRequest(http.MethodGet, "/static/css/main.css", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestRouter_StaticCaching(t *testing.T) {
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithStaticCacheMaxAge(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		maps.Copy(req.Header, header)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	static := get("/static/css/main.css", nil)
+	if got := static.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("expected static Cache-Control %q, got %q", "public, max-age=3600", got)
+	}
+	lastModified := static.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("expected a Last-Modified header on static files")
+	}
+
+	if rec := get("/static/css/main.css", http.Header{"If-Modified-Since": {lastModified}}); rec.Code != http.StatusNotModified {
+		t.Errorf("expected status %d for an unmodified file, got %d", http.StatusNotModified, rec.Code)
+	}
+
+	if got := get("/hello-world", nil).Header().Get("Cache-Control"); got != "" {
+		t.Errorf("expected no Cache-Control on /hello-world, got %q", got)
+	}
+}
+
+func TestHandler_Probes(t *testing.T) {
+	handler := newHandler(t, internal.NewGreeter())
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if got := status("/livez"); got != http.StatusOK {
+		t.Errorf("expected /livez %d, got %d", http.StatusOK, got)
+	}
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz %d before ready, got %d", http.StatusServiceUnavailable, got)
+	}
+
+	handler.SetReady(true)
+	if got := status("/readyz"); got != http.StatusOK {
+		t.Errorf("expected /readyz %d once ready, got %d", http.StatusOK, got)
+	}
+
+	handler.SetReady(false)
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz %d after unready, got %d", http.StatusServiceUnavailable, got)
+	}
+}
+
+func TestHandler_PersonalisedGreeting(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "Named", target: "/hello-world?name=Alice", expected: "Hello, Alice!"},
+		{name: "Named in France", target: "/hello-france?name=Alice", expected: "Bonjour, Alice!"},
+		{name: "Default", target: "/hello-world", expected: "Hello, World!"},
+		{name: "Blank name", target: "/hello-world?name=%20", expected: "Hello, World!"},
+		{name: "Script is escaped", target: "/hello-world?name=%3Cscript%3Ealert(1)%3C/script%3E", expected: "Hello, &lt;script&gt;alert(1)&lt;/script&gt;!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			if result := extractGreeting(body); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+			if strings.Contains(body, "<script>") {
+				t.Errorf("expected the name to be escaped, got %q", body)
+			}
+		})
+	}
+}
+
+func TestRouter_ErrorPages(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		accept       string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "Not found page", method: http.MethodGet, target: "/bogus", expectedCode: http.StatusNotFound, expectedBody: "<h1>404 Not Found</h1>"},
+		{name: "Not found JSON", method: http.MethodGet, target: "/bogus", accept: "application/json", expectedCode: http.StatusNotFound, expectedBody: `{"error":{"code":"not_found","message":"The page you were looking for does not exist."}}`},
+		{name: "Method not allowed page", method: http.MethodPost, target: "/hello-world", expectedCode: http.StatusMethodNotAllowed, expectedBody: "<h1>405 Method Not Allowed</h1>"},
+		{name: "Method not allowed JSON", method: http.MethodPost, target: "/hello-world", accept: "application/json", expectedCode: http.StatusMethodNotAllowed, expectedBody: `{"error":{"code":"method_not_allowed","message":"POST is not supported for /hello-world."}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_LogsGreetingErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler, err := internal.NewHandler(failingGreeter{err: errors.New("translation backend down")}, internal.WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.HelloUKHandler(rec, httptest.NewRequest(http.MethodGet, "/hello-uk", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	logged := buf.String()
+	for _, expected := range []string{`"level":"ERROR"`, `"location":"uk"`, "translation backend down"} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, logged)
+		}
+	}
+}
+
+func TestHandler_ErrorDetailByEnv(t *testing.T) {
+	tests := []struct {
+		env      string
+		expected string
+	}{
+		{env: internal.EnvLocal, expected: "translation backend down"},
+		{env: internal.EnvStaging, expected: "internal server error"},
+		{env: internal.EnvProduction, expected: "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			handler, err := internal.NewHandler(failingGreeter{err: errors.New("translation backend down")},
+				internal.WithEnv(tt.env),
+				internal.WithLogger(discardLogger),
+			)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+
+			for _, accept := range []string{"application/json", "text/html"} {
+				req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				handler.HelloUKHandler(rec, req)
+
+				if rec.Code != http.StatusInternalServerError {
+					t.Errorf("%s: expected status %d, got %d", accept, http.StatusInternalServerError, rec.Code)
+				}
+				body := rec.Body.String()
+				if !strings.Contains(body, tt.expected) {
+					t.Errorf("%s: expected body to contain %q, got %q", accept, tt.expected, body)
+				}
+				if tt.env != internal.EnvLocal && strings.Contains(body, "translation backend down") {
+					t.Errorf("%s: expected the error detail to be hidden, got %q", accept, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Locations(t *testing.T) {
+	greeter := internal.NewGreeter()
+	greeter.Register("spain", "Hola, España!")
+	router := internal.NewRouter(newHandler(t, greeter), internal.NewMetrics())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/locations", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Locations []string `json:"locations"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	expected := []string{internal.LocationFrance, "spain", internal.LocationUK, internal.LocationScotland, internal.LocationWales, internal.LocationWorld}
+	if !slices.Equal(body.Locations, expected) {
+		t.Errorf("expected %v, got %v", expected, body.Locations)
+	}
+}
+
+func TestRouter_HelloLocationPath(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		target       string
+		expectedCode int
+		expected     string
+	}{
+		{target: "/hello/uk", expectedCode: http.StatusOK, expected: "Hello, UK!"},
+		{target: "/hello/world", expectedCode: http.StatusOK, expected: "Hello, World!"},
+		{target: "/hello/france", expectedCode: http.StatusOK, expected: "Bonjour, France!"},
+		{target: "/hello/unknown", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if tt.expected != "" {
+				if result := extractGreeting(rec.Body.String()); result != tt.expected {
+					t.Errorf("expected %q, got %q", tt.expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_GreetingETag(t *testing.T) {
+	handler := newHandler(t, internal.NewGreeter())
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.HelloUKHandler(rec, req)
+		return rec
+	}
+
+	first := get("")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag header")
+	}
+
+	t.Run("MatchingReturns304", func(t *testing.T) {
+		rec := get(etag)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("expected status %d, got %d", http.StatusNotModified, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("expected an empty body, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("MatchingInListReturns304", func(t *testing.T) {
+		if rec := get(`"stale", W/` + etag); rec.Code != http.StatusNotModified {
+			t.Errorf("expected status %d, got %d", http.StatusNotModified, rec.Code)
+		}
+	})
+
+	t.Run("NonMatchingReturns200", func(t *testing.T) {
+		rec := get(`"stale"`)
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if message := extractGreeting(rec.Body.String()); message != "Hello, UK!" {
+			t.Errorf("expected %q, got %q", "Hello, UK!", message)
+		}
+	})
+}
+
+func TestHandler_Version(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []internal.HandlerOption
+		expected internal.BuildInfo
+	}{
+		{
+			name:     "DefaultsWhenUnset",
+			expected: internal.BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown"},
+		},
+		{
+			name:     "ReportsInjectedBuild",
+			opts:     []internal.HandlerOption{internal.WithBuildInfo(internal.BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildDate: "2026-01-02T03:04:05Z"})},
+			expected: internal.BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildDate: "2026-01-02T03:04:05Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := internal.NewHandler(internal.NewGreeter(), tt.opts...)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			internal.NewRouter(handler, internal.NewMetrics()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			var got internal.BuildInfo
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode JSON: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandler_RecordsRequestedLocations(t *testing.T) {
+	greeter := greetertest.NewFakeGreeter(map[string]string{internal.LocationUK: "Hiya, UK!"})
+	router := internal.NewRouter(newHandler(t, greeter), internal.NewMetrics())
+
+	for _, path := range []string{"/hello-uk", "/hello/france", "/hello-world"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := []string{internal.LocationUK, internal.LocationFrance, internal.LocationWorld}
+	if calls := greeter.Calls(); !slices.Equal(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestHandler_Stats(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	for _, path := range []string{"/hello-uk", "/hello-uk", "/hello-world", "/hello/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Greetings map[string]uint64 `json:"greetings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	expected := map[string]uint64{internal.LocationUK: 2, internal.LocationWorld: 1}
+	if !maps.Equal(body.Greetings, expected) {
+		t.Errorf("expected %v, got %v", expected, body.Greetings)
+	}
+}
+
+func TestStats_ConcurrentRecording(t *testing.T) {
+	stats := internal.NewStats()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			stats.RecordGreeting(internal.LocationUK)
+		})
+	}
+	wg.Wait()
+
+	if got := stats.Greetings()[internal.LocationUK]; got != 50 {
+		t.Errorf("expected 50 greetings, got %d", got)
+	}
+}
+
+func TestHandler_Healthz(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, propertyproject.Assets); err != nil {
+		t.Fatalf("failed to copy assets: %v", err)
+	}
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(os.DirFS(dir)), internal.WithLogger(discardLogger))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	healthz := func() (int, string) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode JSON: %v", err)
+		}
+		return rec.Code, body["status"]
+	}
+
+	if code, status := healthz(); code != http.StatusOK || status != "ok" {
+		t.Errorf("expected %d ok with templates present, got %d %s", http.StatusOK, code, status)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "templates", "partials", "greeting.html")); err != nil {
+		t.Fatalf("failed to remove template: %v", err)
+	}
+	if code, status := healthz(); code != http.StatusServiceUnavailable || status != "degraded" {
+		t.Errorf("expected %d degraded with the template removed, got %d %s", http.StatusServiceUnavailable, code, status)
+	}
+}
+
+func TestHandler_GreetingCount(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name     string
+		target   string
+		status   int
+		expected string
+	}{
+		{name: "Zero", target: "/hello-world?count=0", status: http.StatusOK, expected: "Hello, World!"},
+		{name: "One", target: "/hello-world?count=1", status: http.StatusOK, expected: "Hello, World!"},
+		{name: "Many", target: "/hello-world?count=3", status: http.StatusOK, expected: "Hello, World! (x3)"},
+		{name: "Negative", target: "/hello-world?count=-1", status: http.StatusBadRequest},
+		{name: "NotANumber", target: "/hello-world?count=lots", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if result := extractGreeting(rec.Body.String()); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHandler_GreetingLang(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/hello-world?lang=es", expected: "Hola, World!"},
+		{target: "/hello-uk?lang=fr", expected: "Bonjour, UK!"},
+		{target: "/hello-france?lang=xx", expected: "Hello, France!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if result := extractGreeting(rec.Body.String()); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHandler_GreetingCombinesParameters(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/hello-france?name=Alice&lang=es&count=3", expected: "Hola, Alice! (x3)"},
+		{target: "/hello-uk?name=Alice&lang=fr", expected: "Bonjour, Alice!"},
+		{target: "/hello-uk?name=Alice&count=2", expected: "Hello, Alice! (x2)"},
+		{target: "/hello-world?lang=es&count=4", expected: "Hola, World! (x4)"},
+		{target: "/hello-world?name=%20&lang=es&count=1", expected: "Hola, World!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if result := extractGreeting(rec.Body.String()); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRouter_APIv1Greetings(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		expected string
+	}{
+		{
+			name:     "KnownLocation",
+			path:     "/api/v1/greetings/uk",
+			status:   http.StatusOK,
+			expected: `{"location":"uk","message":"Hello, UK!"}`,
+		},
+		{
+			name:     "UnknownLocation",
+			path:     "/api/v1/greetings/atlantis",
+			status:   http.StatusNotFound,
+			expected: `{"error":{"code":"unknown_location","message":"unknown location"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "text/html")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected Content-Type %q, got %q", "application/json", got)
+			}
+			if body := strings.TrimSpace(rec.Body.String()); body != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, body)
+			}
+		})
+	}
+}
+
+func TestHandler_IndexLinksLocations(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	for _, location := range []string{internal.LocationWorld, internal.LocationUK} {
+		if link := `href="/hello/` + location + `"`; !strings.Contains(body, link) {
+			t.Errorf("expected the index to contain %s, got %q", link, body)
+		}
+	}
+}
+
+func TestRouter_APIv1AllGreetings(t *testing.T) {
+	greeter := internal.NewGreeter()
+	greeter.Register("spain", "Hola, España!")
+	router := internal.NewRouter(newHandler(t, greeter), internal.NewMetrics())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/greetings", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected Content-Type %q, got %q", "application/json", got)
+	}
+	var body struct {
+		Greetings []struct {
+			Location string `json:"location"`
+			Message  string `json:"message"`
+		} `json:"greetings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	got := make(map[string]string)
+	var locations []string
+	for _, greeting := range body.Greetings {
+		got[greeting.Location] = greeting.Message
+		locations = append(locations, greeting.Location)
+	}
+	if !slices.Equal(locations, greeter.Locations()) {
+		t.Errorf("expected locations %v, got %v", greeter.Locations(), locations)
+	}
+	for location, expected := range map[string]string{
+		internal.LocationWorld:    "Hello, World!",
+		internal.LocationUK:       "Hello, UK!",
+		internal.LocationScotland: "Hello, Scotland!",
+		internal.LocationFrance:   "Bonjour, France!",
+		"spain":                   "Hola, España!",
+	} {
+		if got[location] != expected {
+			t.Errorf("expected %s to be greeted %q, got %q", location, expected, got[location])
+		}
+	}
+}
+
+func TestRouter_APIv1JSONP(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name        string
+		query       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "NoCallback",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"location":"uk","message":"Hello, UK!"}` + "\n",
+		},
+		{
+			name:        "ValidCallback",
+			query:       "?callback=app.onGreeting",
+			status:      http.StatusOK,
+			contentType: "application/javascript",
+			body:        `/**/app.onGreeting({"location":"uk","message":"Hello, UK!"});` + "\n",
+		},
+		{
+			name:        "InvalidCallback",
+			query:       "?callback=alert(document.cookie)//",
+			status:      http.StatusBadRequest,
+			contentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/greetings/uk"+tt.query, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_TrailingSlashRedirects(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	tests := []struct {
+		name     string
+		target   string
+		status   int
+		location string
+	}{
+		{name: "GreetingPath", target: "/hello-uk/", status: http.StatusMovedPermanently, location: "/hello-uk"},
+		{name: "KeepsQuery", target: "/hello/uk/?name=Alice", status: http.StatusMovedPermanently, location: "/hello/uk?name=Alice"},
+		{name: "Root", target: "/", status: http.StatusOK},
+		{name: "StaticDirectory", target: "/static/css/", status: http.StatusOK},
+		{name: "NoSuchRoute", target: "/nowhere/", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("expected Location %q, got %q", tt.location, got)
+			}
+		})
+	}
+}
+
+func TestRouter_BasePath(t *testing.T) {
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithBasePath("/greeter/"))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/greeter/hello-uk")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d under the base path, got %d", http.StatusOK, rec.Code)
+	}
+	if message := extractGreeting(rec.Body.String()); message != "Hello, UK!" {
+		t.Errorf("expected %q, got %q", "Hello, UK!", message)
+	}
+
+	if rec := get("/greeter/static/css/main.css"); rec.Code != http.StatusOK {
+		t.Errorf("expected static files under the base path, got %d", rec.Code)
+	}
+	if rec := get("/hello-uk"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d outside the base path, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	index := get("/greeter/").Body.String()
+	for _, link := range []string{`href="/greeter/hello/uk"`, `href="/greeter/static/css/main.css"`} {
+		if !strings.Contains(index, link) {
+			t.Errorf("expected the index to contain %s, got %q", link, index)
+		}
+	}
+}
+
+func TestRouter_Maintenance(t *testing.T) {
+	const token = "s3cret"
+
+	handler, err := internal.NewHandler(internal.NewGreeter(),
+		internal.WithShutdown(token, func() {}),
+		internal.WithLogger(discardLogger),
+	)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	setMaintenance := func(token, body string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(body))
+		req.Header.Set(internal.AdminTokenHeader, token)
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	handler.SetMaintenance(true)
+	for _, tc := range []struct{ path, accept, contentType string }{
+		{"/hello-uk", "text/html", "text/html; charset=utf-8"},
+		{"/hello-uk", "application/json", "application/json"},
+		{"/api/v1/greetings/uk", "", "application/json"},
+	} {
+		rec := get(tc.path, tc.accept)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s (%s): expected status %d in maintenance, got %d", tc.path, tc.accept, http.StatusServiceUnavailable, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s (%s): expected Content-Type %q, got %q", tc.path, tc.accept, tc.contentType, got)
+		}
+	}
+	for _, path := range []string{"/livez", "/health"} {
+		if rec := get(path, ""); rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d in maintenance, got %d", path, http.StatusOK, rec.Code)
+		}
+	}
+
+	if got := setMaintenance("wrong", `{"enabled": false}`); got != http.StatusUnauthorized {
+		t.Errorf("expected status %d without the admin token, got %d", http.StatusUnauthorized, got)
+	}
+	if got := setMaintenance(token, `{}`); got != http.StatusBadRequest {
+		t.Errorf("expected status %d without enabled, got %d", http.StatusBadRequest, got)
+	}
+	if got := setMaintenance(token, `{"enabled": false}`); got != http.StatusOK {
+		t.Fatalf("expected status %d switching maintenance off, got %d", http.StatusOK, got)
+	}
+	if rec := get("/hello-uk", "text/html"); rec.Code != http.StatusOK {
+		t.Errorf("expected status %d after maintenance, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestRouter_AddGreeting(t *testing.T) {
+	const token = "s3cret"
+
+	greeter := internal.NewGreeter()
+	handler, err := internal.NewHandler(greeter,
+		internal.WithShutdown(token, func() {}),
+		internal.WithLogger(discardLogger),
+	)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	add := func(token, query, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/greetings"+query, strings.NewReader(body))
+		req.Header.Set(internal.AdminTokenHeader, token)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Adds", func(t *testing.T) {
+		rec := add(token, "", `{"location": "spain", "message": "Hola, España!"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+		if result := greeter.Greet("spain"); result != "Hola, España!" {
+			t.Errorf("expected %q, got %q", "Hola, España!", result)
+		}
+	})
+
+	t.Run("RejectsDuplicates", func(t *testing.T) {
+		for _, location := range []string{"spain", internal.LocationUK} {
+			rec := add(token, "", `{"location": "`+location+`", "message": "Hi!"}`)
+			if rec.Code != http.StatusConflict {
+				t.Errorf("%s: expected status %d, got %d", location, http.StatusConflict, rec.Code)
+			}
+			if result := greeter.Greet(location); result == "Hi!" {
+				t.Errorf("%s: expected the greeting to be kept", location)
+			}
+		}
+	})
+
+	t.Run("Overwrites", func(t *testing.T) {
+		rec := add(token, "?overwrite=true", `{"location": "spain", "message": "¡Buenos días, España!"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+		if result := greeter.Greet("spain"); result != "¡Buenos días, España!" {
+			t.Errorf("expected %q, got %q", "¡Buenos días, España!", result)
+		}
+	})
+
+	t.Run("RejectsInvalidGreetings", func(t *testing.T) {
+		for _, body := range []string{
+			`{"location": "", "message": "Hi!"}`,
+			`{"location": "Spain", "message": "Hi!"}`,
+			`{"location": "../etc", "message": "Hi!"}`,
+			`{"location": "spain-", "message": "Hi!"}`,
+			`{"location": "portugal", "message": " "}`,
+			`{"location": `,
+		} {
+			if rec := add(token, "", body); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+			}
+		}
+	})
+
+	t.Run("RequiresAdminToken", func(t *testing.T) {
+		for _, bad := range []string{"", "wrong"} {
+			rec := add(bad, "", `{"location": "portugal", "message": "Olá, Portugal!"}`)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("token %q: expected status %d, got %d", bad, http.StatusUnauthorized, rec.Code)
+			}
+		}
+		if _, err := greeter.GreetE("portugal"); !errors.Is(err, internal.ErrUnknownLocation) {
+			t.Errorf("expected portugal to stay unknown, got %v", err)
+		}
+	})
+}
+
+func TestRouter_DevBanner(t *testing.T) {
+	for _, env := range []string{internal.EnvLocal, internal.EnvProduction} {
+		t.Run(env, func(t *testing.T) {
+			handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithEnv(env))
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+			router := internal.NewRouter(handler, internal.NewMetrics())
+
+			for _, path := range []string{"/", "/hello-uk"} {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%s: expected status %d, got %d", path, http.StatusOK, rec.Code)
+				}
+				shown := strings.Contains(rec.Body.String(), `class="dev-banner"`)
+				if expected := env == internal.EnvLocal; shown != expected {
+					t.Errorf("%s: expected the DEV banner shown to be %t, got %q", path, expected, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_StaticContentTypes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, propertyproject.Assets); err != nil {
+		t.Fatalf("failed to copy assets: %v", err)
+	}
+	// Sniffing would serve this as HTML.
+	if err := os.WriteFile(filepath.Join(dir, "static", "upload.dat"), []byte("<html><script>alert(1)</script></html>"), 0o644); err != nil {
+		t.Fatalf("failed to write upload: %v", err)
+	}
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(os.DirFS(dir)))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{path: "/static/css/main.css", contentType: "text/css; charset=utf-8"},
+		{path: "/static/js/htmx.min.js", contentType: "text/javascript; charset=utf-8"},
+		{path: "/static/upload.dat", contentType: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("expected X-Content-Type-Options %q, got %q", "nosniff", got)
+			}
+		})
+	}
+}
+
+func TestRouter_OpenAPI(t *testing.T) {
+	for _, basePath := range []string{"", "/greeter"} {
+		t.Run("BasePath="+basePath, func(t *testing.T) {
+			handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithBasePath(basePath))
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+			router := internal.NewRouter(handler, internal.NewMetrics())
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, basePath+"/openapi.json", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected Content-Type %q, got %q", "application/json", got)
+			}
+			var doc struct {
+				OpenAPI string                     `json:"openapi"`
+				Paths   map[string]json.RawMessage `json:"paths"`
+				Servers []struct {
+					URL string `json:"url"`
+				} `json:"servers"`
+				Components struct {
+					Schemas map[string]json.RawMessage `json:"schemas"`
+				} `json:"components"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+				t.Fatalf("failed to decode the OpenAPI document: %v", err)
+			}
+			if !strings.HasPrefix(doc.OpenAPI, "3.") {
+				t.Errorf("expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+			}
+			if _, ok := doc.Paths["/api/v1/greetings/{location}"]; !ok {
+				t.Errorf("expected the greetings path, got %v", slices.Collect(maps.Keys(doc.Paths)))
+			}
+			if _, ok := doc.Components.Schemas["ErrorResponse"]; !ok {
+				t.Error("expected the ErrorResponse schema")
+			}
+			if basePath != "" && (len(doc.Servers) != 1 || doc.Servers[0].URL != basePath) {
+				t.Errorf("expected the server URL %q, got %+v", basePath, doc.Servers)
+			}
+		})
+	}
+}
+
+// openAPIDocument fetches the served OpenAPI document.
+func openAPIDocument(t *testing.T) map[string]any {
+	t.Helper()
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode the OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+// openAPIResponses returns the statuses documented for GET on path.
+func openAPIResponses(t *testing.T, doc map[string]any, path string) map[string]any {
+	t.Helper()
+	paths, _ := doc["paths"].(map[string]any)
+	operation, _ := paths[path].(map[string]any)
+	get, _ := operation["get"].(map[string]any)
+	responses, ok := get["responses"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected GET %s to document its responses", path)
+	}
+	return responses
+}
+
+func TestRouter_OpenAPIDocumentsQueryLimits(t *testing.T) {
+	doc := openAPIDocument(t)
+
+	for _, path := range []string{"/api/v1/greetings", "/api/v1/greetings/{location}"} {
+		responses := openAPIResponses(t, doc, path)
+		for _, status := range []string{"400", "414"} {
+			if _, ok := responses[status]; !ok {
+				t.Errorf("expected GET %s to document a %s response", path, status)
+			}
+		}
+	}
+}
+
+func TestRouter_OpenAPIDocumentsEveryErrorCode(t *testing.T) {
+	// The constants are read from source so a new one cannot be added
+	// without documenting it.
+	file, err := parser.ParseFile(token.NewFileSet(), filepath.Join("..", "..", "internal", "errors.go"), nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse the error codes: %v", err)
+	}
+	var codes []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range spec.Names {
+			if !strings.HasPrefix(name.Name, "ErrorCode") || i >= len(spec.Values) {
+				continue
+			}
+			if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				code, _ := strconv.Unquote(lit.Value)
+				codes = append(codes, code)
+			}
+		}
+		return true
+	})
+	if len(codes) == 0 {
+		t.Fatal("expected to find the ErrorCode constants")
+	}
+
+	doc := openAPIDocument(t)
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	errorResponse, _ := schemas["ErrorResponse"].(map[string]any)
+	properties, _ := errorResponse["properties"].(map[string]any)
+	detail, _ := properties["error"].(map[string]any)
+	detailProperties, _ := detail["properties"].(map[string]any)
+	code, _ := detailProperties["code"].(map[string]any)
+	documented, _ := code["enum"].([]any)
+
+	for _, code := range codes {
+		if !slices.Contains(documented, any(code)) {
+			t.Errorf("expected the ErrorResponse code enum to include %q, got %v", code, documented)
+		}
+	}
+}
+
+func TestRouter_OpenAPIDocumentsForbidden(t *testing.T) {
+	doc := openAPIDocument(t)
+
+	for _, path := range []string{"/api/v1/greetings", "/api/v1/greetings/{location}", "/locations"} {
+		if _, ok := openAPIResponses(t, doc, path)["403"]; !ok {
+			t.Errorf("expected GET %s to document a 403 response", path)
+		}
+	}
+}
+
+func TestRouter_OpenAPICallbackPatternMatchesServer(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc struct {
+		Paths map[string]struct {
+			Get struct {
+				Parameters []struct {
+					Name   string `json:"name"`
+					Schema struct {
+						Pattern string `json:"pattern"`
+					} `json:"schema"`
+				} `json:"parameters"`
+			} `json:"get"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode the OpenAPI document: %v", err)
+	}
+	var pattern string
+	for _, param := range doc.Paths["/api/v1/greetings/{location}"].Get.Parameters {
+		if param.Name == "callback" {
+			pattern = param.Schema.Pattern
+		}
+	}
+	documented, err := regexp.Compile(pattern)
+	if err != nil {
+		t.Fatalf("failed to compile the documented callback pattern %q: %v", pattern, err)
+	}
+
+	segment := strings.Repeat("a", 64)
+	for _, callback := range []string{
+		"cb",
+		"$jsonp_1",
+		"app.handlers.greet",
+		segment,
+		segment + "a",
+		"a.b.c.d",
+		"a.b.c.d.e",
+		"1cb",
+		"cb()",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/greetings/uk?callback="+url.QueryEscape(callback), nil))
+		if accepted := rec.Code == http.StatusOK; accepted != documented.MatchString(callback) {
+			t.Errorf("%q: server answered %d but the documented pattern matches %t", callback, rec.Code, documented.MatchString(callback))
+		}
+	}
+}
+
+func TestRouter_DisabledLocation(t *testing.T) {
+	greeter := internal.NewGreeter()
+	router := internal.NewRouter(newHandler(t, greeter), internal.NewMetrics())
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	greeter.SetEnabled(internal.LocationUK, false)
+	for _, path := range []string{"/hello-uk", "/hello/gb", "/hello/uk-cornwall", "/api/v1/greetings/uk"} {
+		if got := status(path); got != http.StatusNotFound {
+			t.Errorf("%s: expected status %d while disabled, got %d", path, http.StatusNotFound, got)
+		}
+	}
+	for _, path := range []string{"/hello-world", "/hello/uk-scotland"} {
+		if got := status(path); got != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusOK, got)
+		}
+	}
+	if slices.Contains(greeter.Locations(), internal.LocationUK) {
+		t.Errorf("expected a disabled location not to be listed, got %v", greeter.Locations())
+	}
+	if result := greeter.Greet(internal.LocationUK); result != "Hello, World!" {
+		t.Errorf("expected Greet to fall back for a disabled location, got %q", result)
+	}
+
+	greeter.SetEnabled(internal.LocationUK, true)
+	if got := status("/hello-uk"); got != http.StatusOK {
+		t.Errorf("expected status %d once re-enabled, got %d", http.StatusOK, got)
+	}
+}
+
+func TestHandler_TemplateExecutionErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, propertyproject.Assets); err != nil {
+		t.Fatalf("failed to copy assets: %v", err)
+	}
+	// Both templates fail after writing some of the page.
+	broken := `<h1>Partial page</h1>{{index .Locations 99}}`
+	for _, name := range []string{"index.html", "error.html"} {
+		if err := os.WriteFile(filepath.Join(dir, "templates", name), []byte(broken), 0o644); err != nil {
+			t.Fatalf("failed to break %s: %v", name, err)
+		}
+	}
+	handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(os.DirFS(dir)), internal.WithLogger(discardLogger))
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	for _, path := range []string{"/", "/bogus"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+			}
+			if body := rec.Body.String(); strings.Contains(body, "Partial page") {
+				t.Errorf("expected no partial page, got %q", body)
+			}
+		})
+	}
+}
+
+func TestRouter_History(t *testing.T) {
+	const token = "s3cret"
+
+	handler, err := internal.NewHandler(internal.NewGreeter(),
+		internal.WithShutdown(token, func() {}),
+		internal.WithHistorySize(3),
+		internal.WithLogger(discardLogger),
+	)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	router := internal.NewRouter(handler, internal.NewMetrics())
+
+	for _, path := range []string{"/hello/world", "/hello/uk", "/hello/bogus", "/api/v1/greetings/france", "/hello/uk-wales"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	history := func(token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/history", nil)
+		req.Header.Set(internal.AdminTokenHeader, token)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("NewestFirstAndBounded", func(t *testing.T) {
+		rec := history(token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var body struct {
+			Greetings []internal.HistoryEntry `json:"greetings"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode history: %v", err)
+		}
+
+		var locations []string
+		for _, entry := range body.Greetings {
+			locations = append(locations, entry.Location)
+			if entry.Time.IsZero() {
+				t.Errorf("expected a time for %s", entry.Location)
+			}
+		}
+		expected := []string{internal.LocationWales, internal.LocationFrance, internal.LocationUK}
+		if !slices.Equal(locations, expected) {
+			t.Errorf("expected history %v, got %v", expected, locations)
+		}
+	})
+
+	t.Run("RequiresToken", func(t *testing.T) {
+		if rec := history("wrong"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+}
+
+// gatedGreeter holds back greeting its gated location until released.
+type gatedGreeter struct {
+	internal.Greeter
+	gated   string
+	release chan struct{}
+}
+
+func (g gatedGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	if location == g.gated {
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return g.Greeter.GreetCtx(ctx, location)
+}
+
+func TestServer_StreamGreetings(t *testing.T) {
+	greeter := gatedGreeter{Greeter: internal.NewGreeter(), gated: internal.LocationWorld, release: make(chan struct{})}
+	server, err := internal.NewServer(internal.Config{Port: "0", HandlerTimeout: 5 * time.Second},
+		internal.WithServerLogger(discardLogger),
+		internal.WithHandler(newHandler(t, greeter)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/greetings", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("expected Content-Type %q, got %q", "application/x-ndjson", got)
+	}
+
+	type line struct {
+		greeting map[string]string
+		err      error
+	}
+	lines := make(chan line)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(resp.Body)
+		for {
+			text, err := reader.ReadBytes('\n')
+			if len(text) > 0 {
+				var greeting map[string]string
+				if err := json.Unmarshal(text, &greeting); err != nil {
+					lines <- line{err: fmt.Errorf("invalid JSON line %q: %w", text, err)}
+					return
+				}
+				lines <- line{greeting: greeting}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Every location sorting before world must arrive while world is held
+	// back, so they were flushed rather than buffered.
+	var locations []string
+	for _, expected := range []string{internal.LocationFrance, internal.LocationUK, internal.LocationScotland, internal.LocationWales} {
+		select {
+		case got := <-lines:
+			if got.err != nil {
+				t.Fatal(got.err)
+			}
+			locations = append(locations, got.greeting["location"])
+			if got.greeting["location"] != expected {
+				t.Fatalf("expected %q next, got %v", expected, got.greeting)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %q to be flushed, got only %v", expected, locations)
+		}
+	}
+	close(greeter.release)
+
+	got, ok := <-lines
+	if !ok || got.err != nil || got.greeting["message"] != "Hello, World!" {
+		t.Fatalf("expected the world greeting last, got %+v", got)
+	}
+	if extra, ok := <-lines; ok {
+		t.Errorf("expected the stream to end, got %+v", extra)
+	}
+}
+
+func TestRouter_Favicon(t *testing.T) {
+	embedded, err := fs.ReadFile(propertyproject.Assets, "static/favicon.ico")
+	if err != nil {
+		t.Fatalf("failed to read the embedded favicon: %v", err)
+	}
+
+	withoutFavicon := t.TempDir()
+	if err := os.CopyFS(withoutFavicon, propertyproject.Assets); err != nil {
+		t.Fatalf("failed to copy assets: %v", err)
+	}
+	if err := os.Remove(filepath.Join(withoutFavicon, "static", "favicon.ico")); err != nil {
+		t.Fatalf("failed to remove favicon: %v", err)
+	}
+
+	tests := []struct {
+		name                string
+		assets              fs.FS
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        []byte
+	}{
+		{name: "Configured", assets: propertyproject.Assets, expectedStatus: http.StatusOK, expectedContentType: "image/x-icon", expectedBody: embedded},
+		{name: "Missing", assets: os.DirFS(withoutFavicon), expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(tt.assets))
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+			router := internal.NewRouter(handler, internal.NewMetrics())
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if !bytes.Equal(rec.Body.Bytes(), tt.expectedBody) {
+				t.Errorf("expected %d bytes of favicon, got %d", len(tt.expectedBody), rec.Body.Len())
+			}
+		})
+	}
+}
+
+func TestHandler_Themes(t *testing.T) {
+	// The fancy theme overrides only the greeting, so its pages fall back to
+	// the default templates.
+	assets := fstest.MapFS{
+		"templates/themes/fancy/partials/greeting.html": {Data: []byte(`<p class="fancy">{{.Message}}</p>`)},
+	}
+	if err := fs.WalkDir(propertyproject.Assets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(propertyproject.Assets, name)
+		assets[name] = &fstest.MapFile{Data: data}
+		return err
+	}); err != nil {
+		t.Fatalf("failed to copy assets: %v", err)
+	}
+
+	get := func(t *testing.T, theme, path string) string {
+		t.Helper()
+		handler, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(assets), internal.WithTheme(theme))
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "text/html")
+		internal.NewRouter(handler, internal.NewMetrics()).ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	tests := []struct {
+		name        string
+		theme       string
+		path        string
+		contains    string
+		notContains string
+	}{
+		{name: "DefaultIndex", theme: "", path: "/", contains: "<body>", notContains: "theme-dark"},
+		{name: "DarkIndex", theme: "dark", path: "/", contains: `<body class="theme-dark">`},
+		{name: "DarkGreetingFallsBack", theme: "dark", path: "/hello/uk", contains: "<h2>Hello, UK!</h2>"},
+		{name: "FancyGreeting", theme: "fancy", path: "/hello/uk", contains: `<p class="fancy">Hello, UK!</p>`, notContains: "<h2>"},
+		{name: "FancyIndexFallsBack", theme: "fancy", path: "/", contains: "<body>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := get(t, tt.theme, tt.path)
+			if !strings.Contains(body, tt.contains) {
+				t.Errorf("expected body to contain %q, got %q", tt.contains, body)
+			}
+			if tt.notContains != "" && strings.Contains(body, tt.notContains) {
+				t.Errorf("expected body not to contain %q, got %q", tt.notContains, body)
+			}
+		})
+	}
+
+	for _, theme := range []string{"missing", "../templates", "dark/partials"} {
+		t.Run("Invalid/"+theme, func(t *testing.T) {
+			if _, err := internal.NewHandler(internal.NewGreeter(), internal.WithAssets(assets), internal.WithTheme(theme)); err == nil {
+				t.Errorf("expected an error for theme %q", theme)
+			}
+		})
+	}
+}
+
+func TestRouter_AddGreetingKnownLocations(t *testing.T) {
+	const token = "s3cret"
+
+	newRouter := func(t *testing.T, greeter internal.Greeter) http.Handler {
+		t.Helper()
+		handler, err := internal.NewHandler(greeter, internal.WithShutdown(token, func() {}), internal.WithLogger(discardLogger))
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+		return internal.NewRouter(handler, internal.NewMetrics())
+	}
+	add := func(router http.Handler, query, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/greetings"+query, strings.NewReader(body))
+		req.Header.Set(internal.AdminTokenHeader, token)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("RejectsAliases", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		router := newRouter(t, greeter)
+
+		for _, query := range []string{"", "?overwrite=true"} {
+			if rec := add(router, query, `{"location": "gb", "message": "Hiya!"}`); rec.Code != http.StatusBadRequest {
+				t.Errorf("%q: expected status %d, got %d: %s", query, http.StatusBadRequest, rec.Code, rec.Body)
+			}
+		}
+		if result := greeter.Greet("gb"); result != "Hello, UK!" {
+			t.Errorf("expected the alias to keep greeting as uk, got %q", result)
+		}
+	})
+
+	t.Run("RejectsDisabledDuplicates", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		greeter.SetEnabled(internal.LocationUK, false)
+		router := newRouter(t, greeter)
+
+		if rec := add(router, "", `{"location": "uk", "message": "Hiya!"}`); rec.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d: %s", http.StatusConflict, rec.Code, rec.Body)
+		}
+		greeter.SetEnabled(internal.LocationUK, true)
+		if result := greeter.Greet(internal.LocationUK); result != "Hello, UK!" {
+			t.Errorf("expected the disabled greeting to be kept, got %q", result)
+		}
+	})
+
+	t.Run("AllowsNewSubLocations", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		router := newRouter(t, greeter)
+
+		if rec := add(router, "", `{"location": "uk-cornwall", "message": "Dydh da, Kernow!"}`); rec.Code != http.StatusCreated {
+			t.Errorf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("InvalidatesCachedGreeting", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		cached := internal.NewCachingGreeter(greeter, time.Hour)
+		router := newRouter(t, cached)
+
+		if result, _ := cached.GreetE("gb"); result != "Hello, UK!" {
+			t.Fatalf("expected %q, got %q", "Hello, UK!", result)
+		}
+		if rec := add(router, "?overwrite=true", `{"location": "uk", "message": "Hiya, UK!"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+		for _, location := range []string{internal.LocationUK, "gb"} {
+			if result, _ := cached.GreetE(location); result != "Hiya, UK!" {
+				t.Errorf("%s: expected the overwritten greeting, got %q", location, result)
+			}
+		}
+	})
+}
+
+func TestRouter_AddGreetingThroughDecorators(t *testing.T) {
+	const token = "s3cret"
+	body := `{"location": "spain", "message": "Hola, España!"}`
+
+	t.Run("CircuitBreakerConfigured", func(t *testing.T) {
+		server, err := internal.NewServer(internal.Config{Port: "0", AdminToken: token, CircuitBreakerThreshold: 3, CircuitBreakerCooldown: time.Minute},
+			internal.WithServerLogger(discardLogger),
+		)
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/greetings", strings.NewReader(body))
+		req.Header.Set(internal.AdminTokenHeader, token)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+
+		rec = httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello/spain", nil))
+		if !strings.Contains(rec.Body.String(), "Hola, España!") {
+			t.Errorf("expected the registered greeting, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("Stacked", func(t *testing.T) {
+		greeter := internal.NewGreeter()
+		decorated := internal.NewCachingGreeter(
+			internal.NewRetryingGreeter(
+				internal.NewCircuitBreakerGreeter(greeter, 3, time.Minute),
+				3, time.Millisecond),
+			time.Minute)
+		handler, err := internal.NewHandler(decorated, internal.WithShutdown(token, func() {}), internal.WithLogger(discardLogger))
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/greetings", strings.NewReader(body))
+		req.Header.Set(internal.AdminTokenHeader, token)
+		rec := httptest.NewRecorder()
+		internal.NewRouter(handler, internal.NewMetrics()).ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+		}
+		if got := greeter.Greet("spain"); got != "Hola, España!" {
+			t.Errorf("expected the greeting to reach the wrapped greeter, got %q", got)
+		}
+	})
+}
+
+func TestServer_AddGreetingRejectsLargeChunkedBody(t *testing.T) {
+	const token = "s3cret"
+	server, err := internal.NewServer(internal.Config{Port: "0", AdminToken: token, MaxBodyBytes: 64},
+		internal.WithServerLogger(discardLogger),
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	body := `{"location": "spain", "message": "` + strings.Repeat("Hola! ", 32) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/greetings", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set(internal.AdminTokenHeader, token)
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, rec.Code, rec.Body)
+	}
+	var got internal.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if got.Error.Code != internal.ErrorCodeBodyTooLarge {
+		t.Errorf("expected code %q, got %q", internal.ErrorCodeBodyTooLarge, got.Error.Code)
+	}
+}
+
+func TestHandler_PersonalisesWithOneGreeting(t *testing.T) {
+	backend := greetertest.NewFakeGreeter(map[string]string{internal.LocationUK: "Hello, UK!"})
+	router := internal.NewRouter(newHandler(t, internal.NewCachingGreeter(backend, time.Minute)), internal.NewMetrics())
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/hello-uk?name=Alice", expected: "Hello, Alice!"},
+		{target: "/hello-uk?count=3", expected: "Hello, UK! (x3)"},
+		{target: "/hello-uk?lang=es", expected: "Hello, UK!"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if !strings.Contains(rec.Body.String(), tt.expected) {
+			t.Errorf("%s: expected body to contain %q, got %q", tt.target, tt.expected, rec.Body.String())
+		}
+	}
+	if calls := backend.Calls(); len(calls) != 1 {
+		t.Errorf("expected one backend call for every personalised greeting, got %v", calls)
+	}
+}
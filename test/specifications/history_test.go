@@ -0,0 +1,44 @@
+package specifications
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"propertyProject/internal"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		size     int
+		records  int
+		expected []string
+	}{
+		{name: "Empty", size: 3, records: 0, expected: []string{}},
+		{name: "PartlyFull", size: 3, records: 2, expected: []string{"1", "0"}},
+		{name: "Full", size: 3, records: 3, expected: []string{"2", "1", "0"}},
+		{name: "Wrapped", size: 3, records: 7, expected: []string{"6", "5", "4"}},
+		{name: "Disabled", size: 0, records: 2, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := internal.NewHistory(tt.size)
+			for i := range tt.records {
+				history.Record(strconv.Itoa(i), start.Add(time.Duration(i)*time.Second))
+			}
+
+			locations := []string{}
+			for _, entry := range history.Recent() {
+				locations = append(locations, entry.Location)
+			}
+			if !slices.Equal(locations, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, locations)
+			}
+		})
+	}
+}
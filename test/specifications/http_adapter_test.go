@@ -4,12 +4,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"path/filepath"
 	"strings"
 	"testing"
 
 	"propertyProject/internal"
+	"propertyProject/internal/servertest"
 )
 
 // HTTPGreeterAdapter wraps HTTP handlers to satisfy the GreeterContract
@@ -32,6 +31,9 @@ func (a *HTTPGreeterAdapter) Greet(location string) string {
 	case internal.LocationUK:
 		handlerFunc = a.handler.HelloUKHandler
 		path = "/hello-uk"
+	case internal.LocationFrance:
+		handlerFunc = a.handler.HelloFranceHandler
+		path = "/hello-france"
 	default:
 		handlerFunc = a.handler.HelloWorldHandler
 		path = "/hello-world"
@@ -43,8 +45,12 @@ func (a *HTTPGreeterAdapter) Greet(location string) string {
 	handlerFunc(rec, req)
 
 	body, _ := io.ReadAll(rec.Body)
-	// Extract message from HTML response - look for content between <h2> tags
-	content := string(body)
+	return extractGreeting(string(body))
+}
+
+// extractGreeting pulls the message from an HTML greeting partial - the
+// content between the <h2> tags
+func extractGreeting(content string) string {
 	start := strings.Index(content, "<h2>")
 	end := strings.Index(content, "</h2>")
 	if start != -1 && end != -1 {
@@ -55,29 +61,86 @@ func (a *HTTPGreeterAdapter) Greet(location string) string {
 
 // TestGreeter_HTTP runs specs against the HTTP adapter (end-to-end)
 func TestGreeter_HTTP(t *testing.T) {
-	// Change to project root so templates can be found
-	projectRoot := findProjectRoot()
-	originalDir, _ := os.Getwd()
-	os.Chdir(projectRoot)
-	defer os.Chdir(originalDir)
-
 	greeter := internal.NewGreeter()
-	handler := internal.NewHandler(greeter)
+	handler := newHandler(t, greeter)
 	adapter := NewHTTPGreeterAdapter(handler)
 
 	GreeterSpec(t, adapter)
 }
 
-func findProjectRoot() string {
-	dir, _ := os.Getwd()
-	for {
-		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
-			return dir
+func TestNewTestServer(t *testing.T) {
+	server, cleanup := servertest.NewTestServer(t)
+	defer cleanup()
+
+	resp, err := http.Get(server.URL + "/hello-uk")
+	if err != nil {
+		t.Fatalf("greeting request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if message := extractGreeting(string(body)); message != "Hello, UK!" {
+		t.Errorf("expected %q, got %q", "Hello, UK!", message)
+	}
+	// Headers set by the server's middleware show requests go through it,
+	// not just through the router.
+	for _, header := range []string{internal.RequestIDHeader, "X-Content-Type-Options", "Content-Security-Policy"} {
+		if resp.Header.Get(header) == "" {
+			t.Errorf("expected the server's middleware to set %s", header)
+		}
+	}
+}
+
+func TestRouter_HEAD(t *testing.T) {
+	server, _ := servertest.NewTestServer(t)
+	// Compression is asked for explicitly so GET and HEAD are sent alike;
+	// the transport would otherwise only ask, and decode, for GET.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	send := func(t *testing.T, method, url, acceptEncoding string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatalf("failed to build %s request: %v", method, err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
 		}
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			return "."
+		return resp
+	}
+
+	for _, acceptEncoding := range []string{"", "gzip"} {
+		for _, path := range []string{"/hello-world", "/hello/uk", "/", "/api/v1/greetings/france"} {
+			t.Run(acceptEncoding+path, func(t *testing.T) {
+				get := send(t, http.MethodGet, server.URL+path, acceptEncoding)
+				getBody, _ := io.ReadAll(get.Body)
+				get.Body.Close()
+
+				head := send(t, http.MethodHead, server.URL+path, acceptEncoding)
+				headBody, _ := io.ReadAll(head.Body)
+				head.Body.Close()
+
+				if head.StatusCode != http.StatusOK {
+					t.Fatalf("expected status %d, got %d", http.StatusOK, head.StatusCode)
+				}
+				if len(headBody) != 0 {
+					t.Errorf("expected an empty body, got %q", headBody)
+				}
+				for _, header := range []string{"Content-Type", "Content-Length", "Content-Encoding", "ETag"} {
+					if head.Header.Get(header) != get.Header.Get(header) {
+						t.Errorf("expected %s %q as for GET, got %q", header, get.Header.Get(header), head.Header.Get(header))
+					}
+				}
+				if len(getBody) == 0 {
+					t.Error("expected GET to have a body")
+				}
+			})
 		}
-		dir = parent
 	}
 }
@@ -0,0 +1,159 @@
+package specifications
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"propertyProject/internal"
+)
+
+func TestMetrics_CountsGreetingsByLocationAndStatus(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for range 2 {
+		resp, err := http.Get(server.URL + "/hello-world")
+		if err != nil {
+			t.Fatalf("greeting request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	expected := `greeting_requests_total{code="200",location="world"} 2`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("expected metrics to contain %q, got:\n%s", expected, body)
+	}
+	if strings.Contains(string(body), `location="uk"`) {
+		t.Error("expected no uk greetings to be counted")
+	}
+}
+
+func TestMetrics_RecordsLatencyByRouteTemplate(t *testing.T) {
+	metrics := internal.NewMetrics()
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware)
+	router.HandleFunc("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	router.Handle("/metrics", metrics.Handler())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, id := range []string{"1", "2"} {
+		resp, err := http.Get(server.URL + "/slow/" + id)
+		if err != nil {
+			t.Fatalf("slow request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, expected := range []string{
+		`http_request_duration_seconds_count{method="GET",route="/slow/{id}"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/slow/{id}",le="0.01"} 0`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(string(body), `route="/slow/1"`) {
+		t.Error("expected raw paths to stay out of route labels")
+	}
+}
+
+func TestMetrics_RecordsInFlightRequests(t *testing.T) {
+	metrics := internal.NewMetrics()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	held := metrics.InFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	panicking := internal.RecoverMiddleware(discardLogger, "")(metrics.InFlightMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	inFlight := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for line := range strings.Lines(rec.Body.String()) {
+			if value, ok := strings.CutPrefix(line, "http_requests_in_flight "); ok {
+				return strings.TrimSpace(value)
+			}
+		}
+		t.Fatalf("expected an in-flight gauge, got:\n%s", rec.Body)
+		return ""
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		held.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello-uk", nil))
+	}()
+	<-entered
+	if got := inFlight(); got != "1" {
+		t.Errorf("expected 1 request in flight while held, got %s", got)
+	}
+	close(release)
+	<-done
+	if got := inFlight(); got != "0" {
+		t.Errorf("expected 0 requests in flight after completion, got %s", got)
+	}
+
+	panicking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello-uk", nil))
+	if got := inFlight(); got != "0" {
+		t.Errorf("expected 0 requests in flight after a panic, got %s", got)
+	}
+}
+
+func TestMetrics_CountsGreetingsByResolvedLocation(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, location := range []string{"uk-random", "gb", "uk"} {
+		resp, err := http.Get(server.URL + "/hello/" + location)
+		if err != nil {
+			t.Fatalf("greeting request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	expected := `greeting_requests_total{code="200",location="uk"} 3`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("expected metrics to contain %q, got:\n%s", expected, body)
+	}
+	for _, raw := range []string{`location="uk-random"`, `location="gb"`} {
+		if strings.Contains(string(body), raw) {
+			t.Errorf("expected no series labelled %s", raw)
+		}
+	}
+}
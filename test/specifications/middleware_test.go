@@ -0,0 +1,922 @@
+package specifications
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"propertyProject/internal"
+)
+
+func TestLoggingMiddleware_LogsRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	handler := internal.LoggingMiddleware(logger)(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode log line %q: %v", buf.String(), err)
+	}
+
+	if entry["method"] != http.MethodGet {
+		t.Errorf("expected method %q, got %v", http.MethodGet, entry["method"])
+	}
+	if entry["path"] != "/hello-uk" {
+		t.Errorf("expected path %q, got %v", "/hello-uk", entry["path"])
+	}
+	if entry["status"] != float64(http.StatusOK) {
+		t.Errorf("expected status %d, got %v", http.StatusOK, entry["status"])
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Error("expected a duration field")
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		allowed       []string
+		method        string
+		origin        string
+		expectedCode  int
+		expectedAllow string
+		expectMethods bool
+		expectVary    bool
+	}{
+		{name: "Allowed origin", allowed: []string{"https://a.example"}, method: http.MethodGet, origin: "https://a.example", expectedCode: http.StatusOK, expectedAllow: "https://a.example", expectVary: true},
+		{name: "Disallowed origin", allowed: []string{"https://a.example"}, method: http.MethodGet, origin: "https://evil.example", expectedCode: http.StatusOK, expectVary: true},
+		{name: "No origin", allowed: []string{"https://a.example"}, method: http.MethodGet, expectedCode: http.StatusOK, expectVary: true},
+		{name: "Wildcard", allowed: []string{"*"}, method: http.MethodGet, origin: "https://any.example", expectedCode: http.StatusOK, expectedAllow: "*"},
+		{name: "Unconfigured", method: http.MethodGet, origin: "https://a.example", expectedCode: http.StatusOK},
+		{name: "Allowed preflight", allowed: []string{"https://a.example"}, method: http.MethodOptions, origin: "https://a.example", expectedCode: http.StatusNoContent, expectedAllow: "https://a.example", expectMethods: true, expectVary: true},
+		{name: "Disallowed preflight", allowed: []string{"https://a.example"}, method: http.MethodOptions, origin: "https://evil.example", expectedCode: http.StatusNoContent, expectVary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := internal.CORSMiddleware(tt.allowed)(next)
+
+			req := httptest.NewRequest(tt.method, "/hello-uk", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedAllow {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.expectedAllow, got)
+			}
+			methods := rec.Header().Get("Access-Control-Allow-Methods")
+			if tt.expectMethods && !strings.Contains(methods, http.MethodGet) {
+				t.Errorf("expected Access-Control-Allow-Methods to include GET, got %q", methods)
+			}
+			if !tt.expectMethods && methods != "" {
+				t.Errorf("expected no Access-Control-Allow-Methods, got %q", methods)
+			}
+			if vary := slices.Contains(rec.Header().Values("Vary"), "Origin"); vary != tt.expectVary {
+				t.Errorf("expected Vary: Origin %t, got %t", tt.expectVary, vary)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_RejectsRequestsOverTheLimit(t *testing.T) {
+	trusted, err := internal.ParseTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+	limiter := internal.NewRateLimiter(1, 2, trusted)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := request("192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i+1, http.StatusOK, rec.Code)
+		}
+	}
+
+	rec := request("192.0.2.1:5678", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d once the burst is spent, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After %q, got %q", "1", rec.Header().Get("Retry-After"))
+	}
+
+	if rec := request("192.0.2.1:1234", "203.0.113.7, 192.0.2.1"); rec.Code != http.StatusOK {
+		t.Errorf("expected a different forwarded client to be allowed, got %d", rec.Code)
+	}
+	if rec := request("192.0.2.2:1234", "203.0.113.7"); rec.Code != http.StatusOK {
+		t.Errorf("expected the forwarded client's second request to be allowed, got %d", rec.Code)
+	}
+	if rec := request("192.0.2.3:1234", "203.0.113.7"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the forwarded client to be limited by X-Forwarded-For, got %d", rec.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := internal.ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{name: "NoHeader", remoteAddr: "203.0.113.7:1234", expected: "203.0.113.7"},
+		{name: "UntrustedPeerIgnoresHeader", remoteAddr: "203.0.113.7:1234", forwardedFor: []string{"198.51.100.1"}, expected: "203.0.113.7"},
+		{name: "TrustedPeer", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "TrustedSingleIP", remoteAddr: "192.0.2.1:1234", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "TrustedIPv6Peer", remoteAddr: "[2001:db8::1]:1234", forwardedFor: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "SkipsTrustedHops", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1, 10.0.0.2, 10.0.0.3"}, expected: "198.51.100.1"},
+		{name: "StopsAtFirstUntrustedHop", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"6.6.6.6, 198.51.100.1, 10.0.0.2"}, expected: "198.51.100.1"},
+		{name: "AcrossHeaders", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1", "10.0.0.2"}, expected: "198.51.100.1"},
+		{name: "AllHopsTrusted", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"10.0.0.3, 10.0.0.2"}, expected: "10.0.0.3"},
+		{name: "StopsAtMalformedHop", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1, not-an-ip, 10.0.0.2"}, expected: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := internal.ClientIP(req, trusted); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies_RejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := internal.ParseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestRecoverMiddleware_Returns500AndLogsStack(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("template is nil")
+	})
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{name: "HTML", contentType: "text/html; charset=utf-8", body: "<h1>500 Internal Server Error</h1>"},
+		{name: "JSON", accept: "application/json", contentType: "application/json", body: `{"error":{"code":"internal","message":"internal server error"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler := internal.RecoverMiddleware(slog.New(slog.NewJSONHandler(&buf, nil)), "")(panicking)
+
+			req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("expected body to contain %q, got %q", tt.body, rec.Body.String())
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("failed to decode log line %q: %v", buf.String(), err)
+			}
+			if entry["panic"] != "template is nil" {
+				t.Errorf("expected the panic value to be logged, got %v", entry["panic"])
+			}
+			if stack, _ := entry["stack"].(string); !strings.Contains(stack, "goroutine") {
+				t.Errorf("expected a stack trace to be logged, got %q", stack)
+			}
+		})
+	}
+}
+
+func TestRecoverMiddleware_LinksStylesheetUnderBasePath(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("template is nil")
+	})
+
+	tests := []struct {
+		basePath string
+		expected string
+	}{
+		{basePath: "", expected: `href="/static/css/main.css"`},
+		{basePath: "/greeter", expected: `href="/greeter/static/css/main.css"`},
+		{basePath: "greeter/", expected: `href="/greeter/static/css/main.css"`},
+	}
+
+	for _, tt := range tests {
+		t.Run("BasePath="+tt.basePath, func(t *testing.T) {
+			handler := internal.RecoverMiddleware(discardLogger, tt.basePath)(panicking)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/greeter/hello-uk", nil))
+
+			if !strings.Contains(rec.Body.String(), tt.expected) {
+				t.Errorf("expected body to contain %q, got %q", tt.expected, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	var seen string
+	handler := internal.RequestIDMiddleware(internal.LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = internal.RequestIDFromContext(r.Context())
+	})))
+
+	tests := []struct {
+		name     string
+		incoming string
+		reuse    bool
+	}{
+		{name: "Generates when absent", incoming: ""},
+		{name: "Passes through when present", incoming: "abc-123", reuse: true},
+		{name: "Replaces unsafe IDs", incoming: "bad id\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+			if tt.incoming != "" {
+				req.Header.Set(internal.RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(internal.RequestIDHeader)
+			if tt.reuse && id != tt.incoming {
+				t.Errorf("expected request ID %q, got %q", tt.incoming, id)
+			}
+			if !tt.reuse {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("expected a generated UUID, got %q", id)
+				}
+			}
+			if seen != id {
+				t.Errorf("expected context request ID %q, got %q", id, seen)
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("failed to decode log line %q: %v", buf.String(), err)
+			}
+			if entry["request_id"] != id {
+				t.Errorf("expected logged request_id %q, got %v", id, entry["request_id"])
+			}
+		})
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("Hello, World! ", 200)
+	handler := internal.GzipMiddleware(internal.DefaultGzipMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.URL.Query().Get("size") == "small" {
+			io.WriteString(w, "Hello, UK!")
+			return
+		}
+		io.WriteString(w, large)
+	}))
+
+	tests := []struct {
+		name           string
+		target         string
+		acceptEncoding string
+		compressed     bool
+		expected       string
+	}{
+		{name: "Compresses large responses", target: "/", acceptEncoding: "gzip, deflate", compressed: true, expected: large},
+		{name: "Skips without Accept-Encoding", target: "/", expected: large},
+		{name: "Skips when gzip is refused", target: "/", acceptEncoding: "gzip;q=0, deflate", expected: large},
+		{name: "Skips small responses", target: "/?size=small", acceptEncoding: "gzip", expected: "Hello, UK!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			body := rec.Body.Bytes()
+			encoding := rec.Header().Get("Content-Encoding")
+			if tt.compressed {
+				if encoding != "gzip" {
+					t.Fatalf("expected Content-Encoding gzip, got %q", encoding)
+				}
+				reader, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("failed to open gzip body: %v", err)
+				}
+				if body, err = io.ReadAll(reader); err != nil {
+					t.Fatalf("failed to decompress body: %v", err)
+				}
+			} else if encoding != "" {
+				t.Fatalf("expected no Content-Encoding, got %q", encoding)
+			}
+
+			if string(body) != tt.expected {
+				t.Errorf("expected body of %d bytes, got %d", len(tt.expected), len(body))
+			}
+			if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("expected Content-Type to be kept, got %q", got)
+			}
+		})
+	}
+}
+
+func TestGzipMiddleware_AcceptEncoding(t *testing.T) {
+	handler := internal.GzipMiddleware(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello, UK!")
+	}))
+
+	tests := []struct {
+		acceptEncoding string
+		compressed     bool
+	}{
+		{acceptEncoding: "", compressed: false},
+		{acceptEncoding: "gzip", compressed: true},
+		{acceptEncoding: "GZIP;Q=0.5", compressed: true},
+		{acceptEncoding: "deflate, br", compressed: false},
+		{acceptEncoding: "*", compressed: true},
+		{acceptEncoding: "*;q=0", compressed: false},
+		{acceptEncoding: "*;q=0, gzip", compressed: true},
+		{acceptEncoding: "gzip, *;q=0", compressed: true},
+		{acceptEncoding: "*, gzip;q=0", compressed: false},
+		{acceptEncoding: "gzip;q=0, *", compressed: false},
+		{acceptEncoding: "gzip;q=0.0", compressed: false},
+		{acceptEncoding: "gzip;level=1;q=0", compressed: false},
+		{acceptEncoding: "gzip;q=bogus, *", compressed: true},
+		{acceptEncoding: "gzip;q=bogus", compressed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if compressed := rec.Header().Get("Content-Encoding") == "gzip"; compressed != tt.compressed {
+				t.Errorf("expected compressed %t, got %t", tt.compressed, compressed)
+			}
+		})
+	}
+}
+
+func TestGzipMiddleware_WeakensETag(t *testing.T) {
+	handler := internal.GzipMiddleware(0)(internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics()))
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	identity := get("identity", "").Header().Get("ETag")
+	if identity == "" || strings.HasPrefix(identity, "W/") {
+		t.Fatalf("expected a strong ETag for the identity body, got %q", identity)
+	}
+
+	compressed := get("gzip", "")
+	if got := compressed.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, got %q", got)
+	}
+	if got := compressed.Header().Get("ETag"); got != "W/"+identity {
+		t.Errorf("expected the gzip body to carry ETag %q, got %q", "W/"+identity, got)
+	}
+
+	if rec := get("gzip", compressed.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("expected the weak ETag to revalidate with status %d, got %d", http.StatusNotModified, rec.Code)
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	const csp = "default-src 'self'"
+
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) internal.Config
+		hsts bool
+	}{
+		{
+			name: "WithoutTLS",
+			cfg: func(t *testing.T) internal.Config {
+				return internal.Config{Port: "0", ContentSecurityPolicy: csp}
+			},
+		},
+		{
+			name: "WithTLS",
+			cfg: func(t *testing.T) internal.Config {
+				certFile, keyFile, _ := writeSelfSignedCert(t)
+				return internal.Config{Port: "0", ContentSecurityPolicy: csp, TLSCertFile: certFile, TLSKeyFile: keyFile}
+			},
+			hsts: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := internal.NewServer(tt.cfg(t), internal.WithServerLogger(discardLogger))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello-world", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			for header, expected := range map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "DENY",
+				"Content-Security-Policy": csp,
+			} {
+				if got := rec.Header().Get(header); got != expected {
+					t.Errorf("expected %s %q, got %q", header, expected, got)
+				}
+			}
+			if got := rec.Header().Get("Strict-Transport-Security"); (got != "") != tt.hsts {
+				t.Errorf("expected Strict-Transport-Security set to be %v, got %q", tt.hsts, got)
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytesMiddleware(t *testing.T) {
+	// reader echoes the body, answering 413 when it is over the limit.
+	reader := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(body)
+	})
+	handler := internal.MaxBodyBytesMiddleware(8)(reader)
+
+	tests := []struct {
+		name     string
+		body     string
+		chunked  bool
+		expected int
+	}{
+		{name: "WithinLimit", body: "greeting", expected: http.StatusOK},
+		{name: "OverLimit", body: "greetings", expected: http.StatusRequestEntityTooLarge},
+		{name: "OverLimitWithoutContentLength", body: "greetings", chunked: true, expected: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestQueryLimitsMiddleware(t *testing.T) {
+	handler := internal.QueryLimitsMiddleware(32, 3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{name: "NoQuery", query: "", expected: http.StatusOK},
+		{name: "Acceptable", query: "name=Alice&count=3&lang=es", expected: http.StatusOK},
+		{name: "TooLong", query: "name=" + strings.Repeat("a", 28), expected: http.StatusRequestURITooLong},
+		{name: "TooManyParams", query: "a=1&b=2&c=3&d=4", expected: http.StatusBadRequest},
+		{name: "RepeatedKeysCount", query: "a=1&a=2&a=3&a=4", expected: http.StatusBadRequest},
+		{name: "EmptySegmentsIgnored", query: "a=1&&b=2&c=3&", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	t.Run("JSONError", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/greetings?name="+strings.Repeat("a", 64), nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var body internal.ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode error: %v", err)
+		}
+		if body.Error.Code != internal.ErrorCodeQueryTooLong {
+			t.Errorf("expected code %q, got %q", internal.ErrorCodeQueryTooLong, body.Error.Code)
+		}
+	})
+}
+
+func TestChain_ComposesInOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) internal.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" before")
+				next.ServeHTTP(w, r)
+				calls = append(calls, name+" after")
+			})
+		}
+	}
+	handler := internal.Chain(record("first"), record("second"), record("third"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler")
+		}),
+	)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expected := []string{
+		"first before", "second before", "third before",
+		"handler",
+		"third after", "second after", "first after",
+	}
+	if !slices.Equal(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestChain_EmptyIsIdentity(t *testing.T) {
+	handler := internal.Chain()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("expected status %d, got %d", http.StatusTeapot, rec.Code)
+	}
+}
+
+func TestServerTimingMiddleware(t *testing.T) {
+	router := internal.NewRouter(newHandler(t, internal.NewGreeter()), internal.NewMetrics())
+	handler := internal.ServerTimingMiddleware(router)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello-uk", nil))
+
+	header := rec.Header().Get("Server-Timing")
+	raw, ok := strings.CutPrefix(header, "app;dur=")
+	if !ok {
+		t.Fatalf("expected a Server-Timing app duration, got %q", header)
+	}
+	if dur, err := strconv.ParseFloat(raw, 64); err != nil || dur <= 0 {
+		t.Errorf("expected a positive duration, got %q", raw)
+	}
+}
+
+func TestAllowedHostsMiddleware(t *testing.T) {
+	handler := internal.AllowedHostsMiddleware([]string{"greeter.example", "::1"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		host     string
+		expected int
+	}{
+		{host: "greeter.example", expected: http.StatusOK},
+		{host: "Greeter.Example:8080", expected: http.StatusOK},
+		{host: "[::1]:8080", expected: http.StatusOK},
+		{host: "evil.example", expected: http.StatusBadRequest},
+		{host: "greeter.example.evil.example", expected: http.StatusBadRequest},
+		{host: "", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	t.Run("EmptyAllowlist", func(t *testing.T) {
+		handler := internal.AllowedHostsMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+		req.Host = "anything.example"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d without an allowlist, got %d", http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func TestHTTPSRedirectMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		forceHTTPS     bool
+		forwardedProto string
+		expectedStatus int
+		expectedTarget string
+	}{
+		{name: "ForwardedHTTP", forceHTTPS: true, forwardedProto: "http", expectedStatus: http.StatusMovedPermanently, expectedTarget: "https://greeter.example/hello/uk?name=Alice"},
+		{name: "ForwardedHTTPS", forceHTTPS: true, forwardedProto: "https", expectedStatus: http.StatusOK},
+		{name: "NotForwarded", forceHTTPS: true, expectedStatus: http.StatusOK},
+		{name: "FlagOff", forceHTTPS: false, forwardedProto: "http", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := internal.NewServer(internal.Config{Port: "0", ForceHTTPS: tt.forceHTTPS},
+				internal.WithServerLogger(discardLogger),
+				internal.WithHandler(newHandler(t, internal.NewGreeter())),
+			)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://greeter.example/hello/uk?name=Alice", nil)
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.expectedTarget {
+				t.Errorf("expected Location %q, got %q", tt.expectedTarget, got)
+			}
+		})
+	}
+
+	t.Run("KeepsMethod", func(t *testing.T) {
+		handler := internal.HTTPSRedirectMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the request to be redirected")
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://greeter.example/admin/shutdown", nil)
+		req.Header.Set("X-Forwarded-Proto", "http")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("expected status %d for POST, got %d", http.StatusPermanentRedirect, rec.Code)
+		}
+	})
+}
+
+func TestLatencyMiddleware_AbandonsCancelledRequests(t *testing.T) {
+	handler := internal.LatencyMiddleware(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the cancelled request not to be handled")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the delay to end with the request")
+	}
+}
+
+func TestDeadlineMiddleware(t *testing.T) {
+	type observed struct {
+		deadline time.Time
+		ok       bool
+	}
+	seen := make(chan observed, 1)
+	handler := internal.DeadlineMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		seen <- observed{deadline: deadline, ok: ok}
+	}))
+
+	now := time.Now()
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+		// expectedDeadline is roughly when the handler's context ends, or
+		// zero when it has no deadline.
+		expectedDeadline time.Time
+	}{
+		{name: "Missing", header: "", expectedStatus: http.StatusOK},
+		{name: "FutureRFC3339", header: now.Add(time.Minute).Format(time.RFC3339Nano), expectedStatus: http.StatusOK, expectedDeadline: now.Add(time.Minute)},
+		{name: "FutureSeconds", header: "2.5", expectedStatus: http.StatusOK, expectedDeadline: now.Add(2500 * time.Millisecond)},
+		{name: "PastRFC3339", header: now.Add(-time.Minute).Format(time.RFC3339), expectedStatus: http.StatusGatewayTimeout},
+		{name: "PastSeconds", header: "0", expectedStatus: http.StatusGatewayTimeout},
+		{name: "Malformed", header: "tomorrow", expectedStatus: http.StatusBadRequest},
+		{name: "OutOfRange", header: "1e300", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello/uk", nil)
+			if tt.header != "" {
+				req.Header.Set(internal.RequestDeadlineHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				select {
+				case <-seen:
+					t.Error("expected the handler not to run")
+				default:
+				}
+				return
+			}
+
+			got := <-seen
+			if tt.expectedDeadline.IsZero() {
+				if got.ok {
+					t.Errorf("expected no deadline, got %s", got.deadline)
+				}
+				return
+			}
+			if !got.ok {
+				t.Fatal("expected a deadline")
+			}
+			if diff := got.deadline.Sub(tt.expectedDeadline).Abs(); diff > time.Second {
+				t.Errorf("expected a deadline near %s, got %s", tt.expectedDeadline, got.deadline)
+			}
+		})
+	}
+}
+
+func TestServer_RequestDeadlineStopsGreeting(t *testing.T) {
+	greeter := gatedGreeter{Greeter: internal.NewGreeter(), gated: internal.LocationUK, release: make(chan struct{})}
+	server, err := internal.NewServer(internal.Config{Port: "0"},
+		internal.WithServerLogger(discardLogger),
+		internal.WithHandler(newHandler(t, greeter)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello/uk", nil)
+	req.Header.Set(internal.RequestDeadlineHeader, "0.05")
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+}
+
+func TestBlockUserAgentsMiddleware(t *testing.T) {
+	handler := internal.BlockUserAgentsMiddleware([]string{"BadBot", "scrapy", ""})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  int
+	}{
+		{name: "Browser", userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0", expected: http.StatusOK},
+		{name: "Empty", userAgent: "", expected: http.StatusOK},
+		{name: "Blocked", userAgent: "BadBot/1.0", expected: http.StatusForbidden},
+		{name: "BlockedIgnoringCase", userAgent: "Mozilla/5.0 (compatible; badbot/2.1)", expected: http.StatusForbidden},
+		{name: "BlockedSubstring", userAgent: "Scrapy/2.11 (+https://scrapy.org)", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello-uk", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	t.Run("ThroughServer", func(t *testing.T) {
+		server, err := internal.NewServer(internal.Config{Port: "0", BlockedUserAgents: []string{"badbot"}}, internal.WithServerLogger(discardLogger))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/greetings/uk", nil)
+		req.Header.Set("User-Agent", "BadBot/1.0")
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+		var body internal.ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode error: %v", err)
+		}
+		if body.Error.Code != internal.ErrorCodeForbidden {
+			t.Errorf("expected code %q, got %q", internal.ErrorCodeForbidden, body.Error.Code)
+		}
+	})
+}
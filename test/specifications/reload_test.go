@@ -0,0 +1,58 @@
+package specifications
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"propertyProject/internal"
+)
+
+func TestServer_ReloadOnSIGHUP(t *testing.T) {
+	cfg := internal.Config{Env: internal.EnvLocal, Port: "8080", LogLevel: slog.LevelInfo}
+	server, err := internal.NewServer(cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	reloaded := cfg
+	reloaded.LogLevel = slog.LevelDebug
+	reloaded.AllowedOrigins = []string{"https://a.example"}
+	reloaded.Port = "9090"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	go server.WatchReload(ctx, signals, func() (internal.Config, error) { return reloaded, nil })
+
+	if server.Logger().Enabled(ctx, slog.LevelDebug) {
+		t.Fatal("expected debug logging to be off before the reload")
+	}
+
+	signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(time.Second)
+	for !server.Logger().Enabled(ctx, slog.LevelDebug) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected debug logging to be on after SIGHUP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Origin", "https://a.example")
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://a.example" {
+		t.Errorf("expected reloaded allowed origin, got %q", got)
+	}
+
+	if server.Addr != ":8080" {
+		t.Errorf("expected the port change to be ignored, got addr %q", server.Addr)
+	}
+}
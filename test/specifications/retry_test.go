@@ -0,0 +1,111 @@
+package specifications
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"propertyProject/internal"
+)
+
+// recoveringGreeter fails with err until it has been called failures
+// times, then greets
+type recoveringGreeter struct {
+	unknownGreeter
+	err      error
+	failures int
+	calls    int
+}
+
+func (g *recoveringGreeter) GreetE(location string) (string, error) {
+	return g.GreetCtx(context.Background(), location)
+}
+
+func (g *recoveringGreeter) GreetCtx(ctx context.Context, location string) (string, error) {
+	g.calls++
+	if g.calls <= g.failures {
+		return "", g.err
+	}
+	return "Hello, UK!", nil
+}
+
+// recordSleeps returns a sleep that records each wait without waiting.
+func recordSleeps(waits *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+}
+
+func TestRetryingGreeter(t *testing.T) {
+	transient := errors.New("connection reset")
+
+	tests := []struct {
+		name          string
+		err           error
+		failures      int
+		expectedErr   error
+		expectedCalls int
+		expectedWaits []time.Duration
+	}{
+		{name: "SucceedsOnThirdTry", err: transient, failures: 2, expectedCalls: 3, expectedWaits: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}},
+		{name: "AlwaysFails", err: transient, failures: 10, expectedErr: transient, expectedCalls: 4, expectedWaits: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}},
+		{name: "UnknownLocationNotRetried", err: internal.ErrUnknownLocation, failures: 10, expectedErr: internal.ErrUnknownLocation, expectedCalls: 1},
+		{name: "OpenCircuitNotRetried", err: &internal.CircuitOpenError{RetryAfter: time.Minute}, failures: 10, expectedErr: internal.ErrCircuitOpen, expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &recoveringGreeter{err: tt.err, failures: tt.failures}
+			var waits []time.Duration
+			greeter := internal.NewRetryingGreeter(backend, 4, 100*time.Millisecond, internal.WithRetrySleep(recordSleeps(&waits)))
+
+			greeting, err := greeter.GreetE(internal.LocationUK)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && greeting != "Hello, UK!" {
+				t.Errorf("expected %q, got %q", "Hello, UK!", greeting)
+			}
+			if backend.calls != tt.expectedCalls {
+				t.Errorf("expected %d attempts, got %d", tt.expectedCalls, backend.calls)
+			}
+			if !slices.Equal(waits, tt.expectedWaits) {
+				t.Errorf("expected backoff %v, got %v", tt.expectedWaits, waits)
+			}
+		})
+	}
+}
+
+func TestRetryingGreeter_StopsWhenContextEnds(t *testing.T) {
+	backend := &recoveringGreeter{err: errors.New("connection reset"), failures: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	greeter := internal.NewRetryingGreeter(backend, 5, time.Millisecond, internal.WithRetrySleep(func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}))
+
+	if _, err := greeter.GreetCtx(ctx, internal.LocationUK); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context's error, got %v", err)
+	}
+	if backend.calls != 1 {
+		t.Errorf("expected no attempts after cancellation, got %d", backend.calls)
+	}
+
+	t.Run("DefaultSleep", func(t *testing.T) {
+		backend := &recoveringGreeter{err: errors.New("connection reset"), failures: 10}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		greeter := internal.NewRetryingGreeter(backend, 5, time.Hour)
+
+		start := time.Now()
+		if _, err := greeter.GreetCtx(ctx, internal.LocationUK); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to end the wait, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the wait to end with the context, took %s", elapsed)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package specifications
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"propertyProject/internal"
+)
+
+func TestGreeter_RecordsSpanWithLocation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	greeter := internal.NewGreeter(internal.WithTracerProvider(provider))
+	if _, err := greeter.GreetCtx(context.Background(), internal.LocationUK); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	expected := attribute.String("greeting.location", internal.LocationUK)
+	for _, attr := range spans[0].Attributes {
+		if attr == expected {
+			return
+		}
+	}
+	t.Errorf("expected span %q to carry %v, got %v", spans[0].Name, expected, spans[0].Attributes)
+}
+
+func TestNewTracerProvider_NoopWithoutEndpoint(t *testing.T) {
+	provider, shutdown, err := internal.NewTracerProvider(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	_, span := provider.Tracer("test").Start(context.Background(), "span")
+	defer span.End()
+	if span.IsRecording() {
+		t.Error("expected a no-op span")
+	}
+}